@@ -3,15 +3,21 @@ package amock
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"reflect"
 	"regexp"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
 )
 
 // MockRoundTripper implements http.RoundTripper for mocking/testing purposes
@@ -19,8 +25,22 @@ type MockRoundTripper struct {
 	sync.Mutex
 	Responses        []*Response
 	potentialCallers map[string]struct{}
+	failures         []error
+	rnd              *rand.Rand
+	requests         []recordedRequest
+	defaultResponse  *Response
+}
+
+// recordedRequest is a request served by the mock, with a copy of its body.
+type recordedRequest struct {
+	req  *http.Request
+	body []byte
 }
 
+// ErrInjectedFailure is the error returned by RoundTrip for the calls
+// failed on purpose by a response with a failure rate.
+var ErrInjectedFailure = errors.New("amock: injected failure")
+
 // ResponsePayload is an interface that the Body object you pass in your expected responses can respect.
 // It lets you customize the way your body is handled. If you pass an object that does NOT respect ResponsePayload,
 // JSON is the default.
@@ -54,6 +74,13 @@ type Response struct {
 	Cond    func(*Context) bool
 	sticky  bool
 	Mock    *MockRoundTripper
+
+	requestSchema *gojsonschema.Schema
+	bodyFunc      func(*Context) (interface{}, error)
+	failRate      float64
+	failErr       error
+	latencyMin    time.Duration
+	latencyMax    time.Duration
 }
 
 // Context describes the context of the current call to conditional filter functions
@@ -75,9 +102,19 @@ func (c *Context) Callers() map[string]struct{} {
 func NewMock() *MockRoundTripper {
 	return &MockRoundTripper{
 		potentialCallers: map[string]struct{}{},
+		rnd:              rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// Seed seeds the random source of the mock, used by the failure rates
+// and latency ranges of the responses, for the runs to be reproducible.
+func (mc *MockRoundTripper) Seed(seed int64) *MockRoundTripper {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.rnd = rand.New(rand.NewSource(seed))
+	return mc
+}
+
 // Sticky marks the response as reusable. It will not get consumed whenever it is returned.
 func (r *Response) Sticky() *Response {
 	r.Mock.Lock()
@@ -94,6 +131,99 @@ func (r *Response) Headers(h http.Header) *Response {
 	return r
 }
 
+// BodyFunc makes the body of the response computed from the call, by f,
+// when it is returned. The value returned by f is handled as the body
+// passed to Expect: marshaled into JSON, unless it respects ResponsePayload.
+// An error returned by f is returned by RoundTrip.
+func (r *Response) BodyFunc(f func(*Context) (interface{}, error)) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	r.bodyFunc = f
+	return r
+}
+
+// FailRate makes the response fail the given fraction of the calls it
+// matches (from 0 to 1), RoundTrip returning ErrInjectedFailure, or the
+// error given to FailWith, instead of the response, to simulate a flaky
+// dependency. A failed call still consumes the response, unless it is sticky.
+func (r *Response) FailRate(rate float64) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	r.failRate = rate
+	return r
+}
+
+// FailWith makes RoundTrip return err instead of the response, to simulate
+// a transport-level error such as io.EOF or a DNS failure. Unless a failure
+// rate is set, all the calls matching the response fail.
+func (r *Response) FailWith(err error) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	r.failErr = err
+	if r.failRate == 0 {
+		r.failRate = 1
+	}
+	return r
+}
+
+// Delay makes RoundTrip wait d before returning the response.
+// The wait is interrupted if the context of the request is done.
+func (r *Response) Delay(d time.Duration) *Response {
+	return r.LatencyRange(d, d)
+}
+
+// LatencyRange makes RoundTrip wait a random duration between min and
+// max before returning the response. The wait is interrupted if the
+// context of the request is done.
+// It panics if max is lower than min.
+func (r *Response) LatencyRange(min, max time.Duration) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	if max < min {
+		panic(fmt.Sprintf("invalid latency range [%s, %s]", min, max))
+	}
+	r.latencyMin, r.latencyMax = min, max
+	return r
+}
+
+// ExpectRequestSchema makes the mock validate the body of the requests
+// matching the response against the given JSON schema. Requests that
+// do not conform still get the response, but are reported as failures
+// by AssertEmpty and Failures.
+// It panics if the schema is invalid.
+func (r *Response) ExpectRequestSchema(schema string) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("invalid request schema: %s", err))
+	}
+	r.requestSchema = s
+	return r
+}
+
+// checkRequestSchema validates the body of the request r against
+// the request schema of the response, and restores the body for
+// downstream reads. It returns an error if the body does not conform.
+func (r *Response) checkRequestSchema(req *http.Request) error {
+	body, err := readBody(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: failed to read request body: %s", req.Method, req.URL, err)
+	}
+	result, err := r.requestSchema.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return fmt.Errorf("%s %s: invalid JSON request body: %s", req.Method, req.URL, err)
+	}
+	if !result.Valid() {
+		errs := make([]string, 0, len(result.Errors()))
+		for _, e := range result.Errors() {
+			errs = append(errs, e.String())
+		}
+		return fmt.Errorf("%s %s: request body does not match schema: %s", req.Method, req.URL, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // merges two conditional filter functions into a composite one (logical AND)
 func condAND(fs ...func(*Context) bool) func(*Context) bool {
 	return func(c *Context) bool {
@@ -146,6 +276,78 @@ func (r *Response) OnIdentifier(ident string) *Response {
 	return r
 }
 
+// OnPath adds a conditional filter to the response.
+// The response will be selected only if the HTTP path of the request is exactly path.
+func (r *Response) OnPath(path string) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	cond := func(c *Context) bool {
+		return c.Request.URL.Path == path
+	}
+	r.addCond(cond)
+	return r
+}
+
+// OnPathRegex adds a conditional filter to the response.
+// The response will be selected only if the HTTP path of the request matches the
+// regular expression pattern. It panics if pattern is not a valid regular expression.
+func (r *Response) OnPathRegex(pattern string) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	matcher := regexp.MustCompile(pattern)
+	cond := func(c *Context) bool {
+		return matcher.MatchString(c.Request.URL.Path)
+	}
+	r.addCond(cond)
+	return r
+}
+
+// OnMethod adds a conditional filter to the response.
+// The response will be selected only if the HTTP method of the request is method.
+func (r *Response) OnMethod(method string) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	cond := func(c *Context) bool {
+		return strings.EqualFold(c.Request.Method, method)
+	}
+	r.addCond(cond)
+	return r
+}
+
+// OnJSONBody adds a conditional filter to the response.
+// The response will be selected only if the body of the request is a JSON object
+// for which matcher returns true. Empty and non-JSON bodies do not match.
+// The body is restored, to be read again by the other filters and the caller.
+func (r *Response) OnJSONBody(matcher func(map[string]interface{}) bool) *Response {
+	r.Mock.Lock()
+	defer r.Mock.Unlock()
+	cond := func(c *Context) bool {
+		body, err := readBody(c.Request)
+		if err != nil || len(body) == 0 {
+			return false
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(body, &m); err != nil {
+			return false
+		}
+		return matcher(m)
+	}
+	r.addCond(cond)
+	return r
+}
+
+// readBody reads the body of the request req, and
+// restores it for downstream reads.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, err
+}
+
 // On adds a conditional filter to the response.
 func (r *Response) On(f func(*Context) bool) *Response {
 	r.Mock.Lock()
@@ -196,6 +398,21 @@ func (mc *MockRoundTripper) Expect(status int, body interface{}) *Response {
 	return resp
 }
 
+// Default sets the fallback response, returned when none of the expected responses
+// matches a call, e.g. a catch-all 404. It is never consumed, and is ignored by AssertEmpty.
+// The other components can be further specified by chaining setter calls on the response object.
+func (mc *MockRoundTripper) Default(status int, body interface{}) *Response {
+	mc.Lock()
+	defer mc.Unlock()
+
+	bodyPL, ok := body.(ResponsePayload)
+	if !ok {
+		bodyPL = JSON{body}
+	}
+	mc.defaultResponse = &Response{Status: status, Body: bodyPL, Mock: mc, sticky: true}
+	return mc.defaultResponse
+}
+
 // Hack to fix method vs function references
 //
 // var f foo.Foo
@@ -212,37 +429,48 @@ func getFunctionName(i interface{}) string {
 // RoundTrip respects http.RoundTripper. It finds the code path taken to get to here, and returns the first matching expected response.
 func (mc *MockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 
-	mc.Lock()
-	defer mc.Unlock()
+	ctx := &Context{Request: r, mock: mc}
 
-	if len(mc.Responses) == 0 {
-		return nil, ErrUnexpectedCall("no more expected responses")
+	resp, latency, fail, err := mc.match(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := &Context{Request: r, mock: mc}
-
-	var resp *Response
+	// Wait without holding the lock, for concurrent calls to be served.
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
 
-	for i, rsp := range mc.Responses {
-		if rsp.Cond == nil || rsp.Cond(ctx) {
-			// Delete elem in place
-			if !rsp.sticky {
-				mc.Responses = append(mc.Responses[:i], mc.Responses[i+1:]...)
-			}
-			resp = rsp
-			break
+	if fail {
+		if resp.failErr != nil {
+			return nil, resp.failErr
 		}
+		return nil, ErrInjectedFailure
 	}
 
-	if resp == nil {
-		return nil, ErrUnexpectedCall("remaining responses have unmet conditions")
+	body := resp.Body
+	if resp.bodyFunc != nil {
+		b, err := resp.bodyFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		pl, ok := b.(ResponsePayload)
+		if !ok {
+			pl = JSON{b}
+		}
+		body = pl
 	}
 
 	var respBody []byte
-	var err error
 
-	if resp.Body != nil {
-		respBody, err = resp.Body.Payload()
+	if body != nil {
+		respBody, err = body.Payload()
 		if err != nil {
 			return nil, err
 		}
@@ -261,12 +489,79 @@ func (mc *MockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	}, nil
 }
 
+// match returns the first expected response matching the call ctx,
+// along with the latency and whether the call must fail, drawn from
+// the random source of the mock.
+func (mc *MockRoundTripper) match(ctx *Context) (*Response, time.Duration, bool, error) {
+
+	mc.Lock()
+	defer mc.Unlock()
+
+	r := ctx.Request
+
+	if len(mc.Responses) == 0 && mc.defaultResponse == nil {
+		return nil, 0, false, ErrUnexpectedCall("no more expected responses")
+	}
+
+	var resp *Response
+
+	for i, rsp := range mc.Responses {
+		if rsp.Cond == nil || rsp.Cond(ctx) {
+			// Delete elem in place
+			if !rsp.sticky {
+				mc.Responses = append(mc.Responses[:i], mc.Responses[i+1:]...)
+			}
+			resp = rsp
+			break
+		}
+	}
+
+	// Fall back to the default response, if any.
+	if resp == nil {
+		if d := mc.defaultResponse; d != nil && (d.Cond == nil || d.Cond(ctx)) {
+			resp = d
+		}
+	}
+
+	if resp == nil {
+		return nil, 0, false, ErrUnexpectedCall("remaining responses have unmet conditions")
+	}
+
+	if resp.requestSchema != nil {
+		if err := resp.checkRequestSchema(r); err != nil {
+			mc.failures = append(mc.failures, err)
+		}
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	mc.requests = append(mc.requests, recordedRequest{req: r.Clone(r.Context()), body: body})
+
+	if mc.rnd == nil {
+		mc.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	latency := resp.latencyMin
+	if d := resp.latencyMax - resp.latencyMin; d > 0 {
+		latency += time.Duration(mc.rnd.Int63n(int64(d) + 1))
+	}
+	fail := resp.failRate > 0 && mc.rnd.Float64() < resp.failRate
+
+	return resp, latency, fail, nil
+}
+
 // AssertEmpty ensures all expected responses have been consumed.
-// It will call t.Error() detailing the remaining unconsumed responses.
+// It will call t.Error() detailing the remaining unconsumed responses,
+// and the requests that did not match their expected schema.
 func (mc *MockRoundTripper) AssertEmpty(t *testing.T) {
 	mc.Lock()
 	defer mc.Unlock()
 
+	for _, f := range mc.failures {
+		t.Error(f)
+	}
+
 	i := 0
 	for _, r := range mc.Responses {
 		// ignore sticky responses
@@ -280,6 +575,58 @@ func (mc *MockRoundTripper) AssertEmpty(t *testing.T) {
 	}
 }
 
+// Requests returns the requests served by the mock, in order.
+// The body of each request can be read, from a copy taken when it was served.
+func (mc *MockRoundTripper) Requests() []*http.Request {
+	mc.Lock()
+	defer mc.Unlock()
+	ret := make([]*http.Request, 0, len(mc.requests))
+	for _, rr := range mc.requests {
+		ret = append(ret, rr.request())
+	}
+	return ret
+}
+
+// LastRequest returns the last request served by the mock, or nil.
+func (mc *MockRoundTripper) LastRequest() *http.Request {
+	mc.Lock()
+	defer mc.Unlock()
+	if len(mc.requests) == 0 {
+		return nil
+	}
+	return mc.requests[len(mc.requests)-1].request()
+}
+
+// AssertCalled ensures the mock served n requests.
+// It will call t.Error() listing the requests served otherwise.
+func (mc *MockRoundTripper) AssertCalled(t *testing.T, n int) {
+	mc.Lock()
+	defer mc.Unlock()
+
+	if len(mc.requests) != n {
+		calls := make([]string, 0, len(mc.requests))
+		for _, rr := range mc.requests {
+			calls = append(calls, rr.req.Method+" "+rr.req.URL.String())
+		}
+		t.Errorf("expected %d calls, got %d: %v", n, len(mc.requests), calls)
+	}
+}
+
+// request returns a copy of the recorded request, with a fresh body.
+func (rr recordedRequest) request() *http.Request {
+	req := rr.req.Clone(rr.req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(rr.body))
+	return req
+}
+
+// Failures returns the errors recorded while serving the calls,
+// such as request bodies not matching their expected schema.
+func (mc *MockRoundTripper) Failures() []error {
+	mc.Lock()
+	defer mc.Unlock()
+	return append([]error{}, mc.failures...)
+}
+
 // ErrUnexpectedCall crafts an error including a stack trace, to pinpoint a call that did not match
 // any of the configured responses
 func ErrUnexpectedCall(reason string) error {
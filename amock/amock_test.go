@@ -1,8 +1,17 @@
 package amock
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/loopfz/gadgeto/amock/foo"
 )
@@ -90,3 +99,393 @@ No server is available to handle this request.
 
 	mock.AssertEmpty(t)
 }
+
+func TestExpectRequestSchema(t *testing.T) {
+
+	schema := `{
+		"type": "object",
+		"required": ["identifier", "bar_count"],
+		"properties": {
+			"identifier": {"type": "string"},
+			"bar_count": {"type": "integer", "minimum": 0}
+		}
+	}`
+
+	mock := NewMock()
+	foo.Client.Transport = mock
+
+	mock.Expect(200, foo.Foo{Identifier: "f1", BarCount: 1}).OnFunc((*foo.Foo).UpdateFoo).ExpectRequestSchema(schema)
+
+	f := &foo.Foo{Identifier: "f1", BarCount: 1}
+	if _, err := f.UpdateFoo(); err != nil {
+		t.Fatal(err)
+	}
+	if failures := mock.Failures(); len(failures) != 0 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+
+	mock.Expect(200, foo.Foo{Identifier: "f1", BarCount: -1}).OnFunc((*foo.Foo).UpdateFoo).ExpectRequestSchema(schema)
+
+	f.BarCount = -1
+	if _, err := f.UpdateFoo(); err != nil {
+		t.Fatal(err)
+	}
+	failures := mock.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 failure, got %v", failures)
+	}
+	if !strings.Contains(failures[0].Error(), "bar_count") {
+		t.Errorf("failure should name the invalid field: %s", failures[0])
+	}
+}
+
+func TestExpectRequestSchemaRestoresBody(t *testing.T) {
+
+	mock := NewMock()
+	mock.Expect(200, nil).ExpectRequestSchema(`{"type": "object"}`)
+
+	req, err := http.NewRequest("POST", "http://www.foo.com/foo", strings.NewReader(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"foo":"bar"}` {
+		t.Errorf("request body not restored: %s", b)
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestOnMethod(t *testing.T) {
+
+	mock := NewMock()
+	mock.Expect(200, foo.Foo{Identifier: "f1"}).OnMethod("PUT")
+
+	req, err := http.NewRequest("GET", "http://www.foo.com/foo/f1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.RoundTrip(req); err == nil {
+		t.Error("should not have returned the PUT response for a GET")
+	}
+
+	req, err = http.NewRequest("PUT", "http://www.foo.com/foo/f1", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := mock.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestOnPath(t *testing.T) {
+
+	mock := NewMock()
+	mock.Expect(200, foo.Foo{Identifier: "f1"}).OnPath("/v2/foo")
+	mock.Expect(200, foo.Foo{Identifier: "f2"}).OnPathRegex(`^/v2/foo/\d+$`)
+
+	for _, path := range []string{"/v1/foo", "/v2/foo/bar", "/v2/foo/", "/v1/foo/42"} {
+		req, err := http.NewRequest("GET", "http://www.foo.com"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mock.RoundTrip(req); err == nil {
+			t.Errorf("%s should not have matched", path)
+		}
+	}
+	for _, path := range []string{"/v2/foo", "/v2/foo/42"} {
+		req, err := http.NewRequest("GET", "http://www.foo.com"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mock.RoundTrip(req); err != nil {
+			t.Errorf("%s should have matched: %s", path, err)
+		}
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestOnPathRegexInvalid(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an invalid regex should panic at registration")
+		}
+	}()
+	NewMock().Expect(200, nil).OnPathRegex(`^/foo/(`)
+}
+
+func TestOnJSONBody(t *testing.T) {
+
+	mock := NewMock()
+	isFoo := func(id string) func(map[string]interface{}) bool {
+		return func(m map[string]interface{}) bool { return m["identifier"] == id }
+	}
+	mock.Expect(200, foo.Foo{Identifier: "f1", BarCount: 1}).OnJSONBody(isFoo("f1")).Sticky()
+	mock.Expect(201, foo.Foo{Identifier: "f2", BarCount: 2}).OnJSONBody(isFoo("f2")).Sticky()
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"identifier": "f2"}`, 201},
+		{`{"identifier": "f1"}`, 200},
+		{`{"identifier": "f3"}`, 0},
+		{`not json`, 0},
+		{`["f1"]`, 0},
+		{``, 0},
+	} {
+		req, err := http.NewRequest("PUT", "http://www.foo.com/foo", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mock.RoundTrip(req)
+		if tc.status == 0 {
+			if err == nil {
+				t.Errorf("%q should not have matched", tc.body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %s", tc.body, err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.body, tc.status, resp.StatusCode)
+		}
+		// The body is still readable by the caller.
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.body {
+			t.Errorf("request body not restored: %s", b)
+		}
+	}
+}
+
+func TestFailRate(t *testing.T) {
+
+	outcomes := func(seed int64) []bool {
+		mock := NewMock().Seed(seed)
+		mock.Expect(200, nil).FailRate(0.2).Sticky()
+		ret := make([]bool, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			req, err := http.NewRequest("GET", "http://www.foo.com/foo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = mock.RoundTrip(req)
+			if err != nil && err != ErrInjectedFailure {
+				t.Fatal(err)
+			}
+			ret = append(ret, err != nil)
+		}
+		return ret
+	}
+
+	first := outcomes(42)
+	failed := 0
+	for _, f := range first {
+		if f {
+			failed++
+		}
+	}
+	if failed < 150 || failed > 250 {
+		t.Errorf("expected about 200 failures out of 1000 calls, got %d", failed)
+	}
+	if fmt.Sprint(first) != fmt.Sprint(outcomes(42)) {
+		t.Error("the same seed should fail the same calls")
+	}
+}
+
+func TestLatencyRange(t *testing.T) {
+
+	mock := NewMock().Seed(1)
+	mock.Expect(200, nil).LatencyRange(10*time.Millisecond, 20*time.Millisecond)
+	mock.Expect(200, nil).LatencyRange(time.Minute, time.Minute)
+
+	req, err := http.NewRequest("GET", "http://www.foo.com/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := mock.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("expected a latency of at least 10ms, got %s", d)
+	}
+
+	// The wait is interrupted by the context of the request.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req = req.WithContext(ctx)
+	if _, err := mock.RoundTrip(req); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline of the request to be exceeded, got %v", err)
+	}
+}
+
+func TestRequests(t *testing.T) {
+
+	mock := NewMock()
+	foo.Client.Transport = mock
+
+	if mock.LastRequest() != nil {
+		t.Error("no request expected before the first call")
+	}
+
+	mock.Expect(200, foo.Foo{Identifier: "f1"})
+	mock.Expect(200, foo.Foo{Identifier: "f1", BarCount: 2})
+
+	f, err := foo.GetFoo("f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BarCount = 2
+	if _, err := f.UpdateFoo(); err != nil {
+		t.Fatal(err)
+	}
+	mock.AssertCalled(t, 2)
+
+	reqs := mock.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if reqs[0].Method != "GET" || reqs[0].URL.String() != "http://www.foo.com/foo/f1" {
+		t.Errorf("unexpected first request %s %s", reqs[0].Method, reqs[0].URL)
+	}
+	last := mock.LastRequest()
+	if last.Method != "PUT" || last.URL.String() != "http://www.foo.com/foo/f1" {
+		t.Errorf("unexpected last request %s %s", last.Method, last.URL)
+	}
+	// The body can be read from each copy.
+	for i := 0; i < 2; i++ {
+		b, err := ioutil.ReadAll(mock.LastRequest().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != `{"identifier":"f1","bar_count":2}` {
+			t.Errorf("unexpected recorded body %s", b)
+		}
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestDelay(t *testing.T) {
+
+	mock := NewMock()
+	mock.Expect(200, nil).Delay(20 * time.Millisecond)
+	mock.Expect(200, nil).Delay(time.Minute)
+
+	req, err := http.NewRequest("GET", "http://www.foo.com/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := mock.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("expected a delay of 20ms, got %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := mock.RoundTrip(req.WithContext(ctx)); err != context.Canceled {
+		t.Errorf("expected the request to be canceled, got %v", err)
+	}
+}
+
+func TestFailWith(t *testing.T) {
+
+	mock := NewMock()
+	foo.Client.Transport = mock
+
+	dnsErr := &net.DNSError{Err: "no such host", Name: "www.foo.com", IsNotFound: true}
+	mock.Expect(200, foo.Foo{Identifier: "f1"}).FailWith(io.EOF)
+	mock.Expect(200, foo.Foo{Identifier: "f1"}).FailWith(dnsErr)
+
+	if _, err := foo.GetFoo("f1"); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	var de *net.DNSError
+	if _, err := foo.GetFoo("f1"); !errors.As(err, &de) || !de.IsNotFound {
+		t.Errorf("expected a DNS error, got %v", err)
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestDefault(t *testing.T) {
+
+	mock := NewMock()
+	foo.Client.Transport = mock
+
+	mock.Default(404, Raw(`not found`))
+	mock.Expect(200, foo.Foo{Identifier: "f1"}).OnIdentifier("f1")
+
+	// Unmatched calls fall back to the default response.
+	if _, err := foo.GetFoo("f2"); err == nil || err.Error() != "got http error 404" {
+		t.Errorf("expected the default 404, got %v", err)
+	}
+	f, err := foo.GetFoo("f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Identifier != "f1" {
+		t.Errorf("unexpected foo %+v", f)
+	}
+	// The default is not consumed, even once the
+	// expected responses are.
+	if _, err := foo.GetFoo("f1"); err == nil || err.Error() != "got http error 404" {
+		t.Errorf("expected the default 404, got %v", err)
+	}
+	mock.AssertEmpty(t)
+}
+
+func TestBodyFunc(t *testing.T) {
+
+	mock := NewMock()
+	foo.Client.Transport = mock
+
+	// Upsert: echo the posted object, with a generated bar count.
+	mock.Expect(200, nil).BodyFunc(func(c *Context) (interface{}, error) {
+		var f foo.Foo
+		if err := json.NewDecoder(c.Request.Body).Decode(&f); err != nil {
+			return nil, err
+		}
+		f.BarCount = 42
+		return f, nil
+	}).Sticky()
+
+	for _, ident := range []string{"f1", "f2"} {
+		f, err := (&foo.Foo{Identifier: ident}).UpdateFoo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Identifier != ident || f.BarCount != 42 {
+			t.Errorf("unexpected foo %+v", f)
+		}
+	}
+
+	mock = NewMock()
+	mock.Expect(200, nil).BodyFunc(func(c *Context) (interface{}, error) {
+		return nil, errors.New("no body")
+	})
+	req, err := http.NewRequest("GET", "http://www.foo.com/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mock.RoundTrip(req); err == nil || err.Error() != "no body" {
+		t.Errorf("expected the error of the body func, got %v", err)
+	}
+}
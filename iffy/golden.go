@@ -0,0 +1,120 @@
+package iffy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UpdateGoldenEnv is the environment variable which, when set to a
+// non-empty value, makes ExpectGolden checkers rewrite their golden
+// files with the response bodies instead of comparing them, e.g.:
+//
+//	IFFY_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "IFFY_UPDATE_GOLDEN"
+
+// ExpectGolden checks that the response body matches the content of
+// the golden file at path. JSON bodies are normalized (indented, with
+// sorted object keys) before the comparison, and stored normalized, so
+// that golden files are stable and readable. Mismatches are reported
+// with a line diff of the expected and actual bodies.
+// When the UpdateGoldenEnv environment variable is set, the golden
+// file is written with the body, and the checker succeeds.
+func ExpectGolden(path string) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		actual := normalizeGolden(body)
+		if os.Getenv(UpdateGoldenEnv) != "" {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("Failed to update golden file: %s", err)
+			}
+			if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+				return fmt.Errorf("Failed to update golden file: %s", err)
+			}
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("Missing golden file %s: run with %s=1 to create it", path, UpdateGoldenEnv)
+			}
+			return fmt.Errorf("Failed to read golden file: %s", err)
+		}
+		expected := normalizeGolden(string(b))
+		if expected != actual {
+			return fmt.Errorf("Body does not match golden file %s (-expected +actual):\n%s", path, lineDiff(expected, actual))
+		}
+		return nil
+	}
+}
+
+// normalizeGolden indents JSON documents, which also sorts the
+// keys of their objects, and terminates s with a newline.
+// Numbers are kept as written, not rounded to float64.
+func normalizeGolden(s string) string {
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err == nil && dec.Decode(new(json.RawMessage)) == io.EOF {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err == nil {
+			return buf.String()
+		}
+	}
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// lineDiff returns a diff of the lines of a and b, computed from their
+// longest common subsequence: removed lines are prefixed with "-",
+// added lines with "+", and common lines with a space.
+func lineDiff(a, b string) string {
+	al := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	bl := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common
+	// subsequence of al[i:] and bl[j:].
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(al) || j < len(bl) {
+		switch {
+		case i < len(al) && j < len(bl) && al[i] == bl[j]:
+			sb.WriteString("  " + al[i] + "\n")
+			i++
+			j++
+		case j == len(bl) || i < len(al) && lcs[i+1][j] >= lcs[i][j+1]:
+			sb.WriteString("- " + al[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + bl[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,178 @@
+package iffy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// HAR (HTTP Archive) 1.2 format, as documented by
+// http://www.softwareishard.com/blog/har-12-spec/
+
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harBody        `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harBody struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// RecordHAR makes the tester capture every request/response
+// exchanged during Run, and write them to a HAR file at path.
+// The file can be loaded into browser devtools for inspection.
+func (t *Tester) RecordHAR(path string) {
+	t.harPath = path
+}
+
+func (t *Tester) recordHAR(name string, req *http.Request, reqBody string, resp *http.Response, respBody string, started time.Time, elapsed time.Duration) {
+	if t.harPath == "" {
+		return
+	}
+	u := *req.URL
+	u.Scheme = "http"
+	u.Host = req.Host
+	if u.Host == "" {
+		u.Host = "localhost"
+	}
+	query := []harNameValue{}
+	for k, vals := range req.URL.Query() {
+		for _, v := range vals {
+			query = append(query, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.Slice(query, func(i, j int) bool { return query[i].Name < query[j].Name })
+
+	hr := harRequest{
+		Method:      req.Method,
+		URL:         u.String(),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     harHeaders(req.Header),
+		QueryString: query,
+		Cookies:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(reqBody),
+	}
+	if reqBody != "" {
+		hr.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: reqBody}
+	}
+	ms := float64(elapsed) / float64(time.Millisecond)
+
+	t.harEntries = append(t.harEntries, harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         hr,
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(resp.Header),
+			Cookies:     []harNameValue{},
+			Content: harBody{
+				Size:     len(respBody),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     respBody,
+			},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		},
+		Timings: harTimings{Wait: ms},
+		Comment: name,
+	})
+}
+
+func (t *Tester) writeHAR() error {
+	if t.harPath == "" {
+		return nil
+	}
+	entries := t.harEntries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	b, err := json.MarshalIndent(harLog{
+		Log: harContent{
+			Version: "1.2",
+			Creator: harCreator{Name: "iffy", Version: "1.0"},
+			Entries: entries,
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.harPath, b, 0644)
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	ret := []harNameValue{}
+	for k, vals := range h {
+		for _, v := range vals {
+			ret = append(ret, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
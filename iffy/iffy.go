@@ -2,22 +2,45 @@ package iffy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xeipuuv/gojsonschema"
 )
 
+// defaultSeed is the seed of the random source of the
+// templating funcs, unless set with (*Tester).Seed.
+const defaultSeed = 1
+
 type Tester struct {
 	t      *testing.T
 	r      http.Handler
 	Calls  []*Call
 	values Values
 	Fatal  bool
+
+	harPath      string
+	harEntries   []harEntry
+	queryCounter QueryCounter
+	rnd          *rand.Rand
+	beforeEach   func(Call)
+	afterEach    func(Call, *http.Response)
+	basePath     string
+	results      []callResult
 }
 
 type Headers map[string]string
@@ -31,6 +54,10 @@ type Call struct {
 	host       string
 	respObject interface{}
 	checkers   []Checker
+
+	bearerToken string
+	basicAuth   *[2]string
+	sideEffects []func() error
 }
 
 func (c *Call) ResponseObject(respObject interface{}) *Call {
@@ -43,6 +70,22 @@ func (c *Call) Headers(h Headers) *Call {
 	return c
 }
 
+// BearerToken sets the Authorization header of the request to
+// a bearer token. The token is templated, so that it can be taken
+// from the response of a previous call, e.g. {{.login.token}}.
+func (c *Call) BearerToken(tmplOrToken string) *Call {
+	c.bearerToken = tmplOrToken
+	return c
+}
+
+// BasicAuth sets the Authorization header of the request to
+// use HTTP basic authentication. The user and the password are
+// templated.
+func (c *Call) BasicAuth(user, pass string) *Call {
+	c.basicAuth = &[2]string{user, pass}
+	return c
+}
+
 func (c *Call) Host(h string) *Call {
 	c.host = h
 	return c
@@ -53,8 +96,46 @@ func (c *Call) Checkers(ch ...Checker) *Call {
 	return c
 }
 
+// ExpectSideEffect adds a probe checking a side effect of the call
+// that is not observable in the response, e.g. a row inserted in the
+// test database, or an event published. The probes are run in order
+// once the response is received, if its checkers succeeded.
+func (c *Call) ExpectSideEffect(probe func() error) *Call {
+	c.sideEffects = append(c.sideEffects, probe)
+	return c
+}
+
 type Checker func(r *http.Response, body string, respObject interface{}) error
 
+// QueryCounter counts the database queries issued while serving
+// a call. It is implemented by zesty.QueryCounter.
+type QueryCounter interface {
+	Count() int
+	Reset()
+}
+
+// callInfo holds the measures taken by the tester while
+// serving a call. It is attached to the context of the
+// request of the response passed to the checkers.
+type callInfo struct {
+	queries        int
+	queriesCounted bool
+	duration       time.Duration
+}
+
+type callInfoKey struct{}
+
+func getCallInfo(r *http.Response) *callInfo {
+	if r.Request == nil {
+		return &callInfo{}
+	}
+	info, ok := r.Request.Context().Value(callInfoKey{}).(*callInfo)
+	if !ok {
+		return &callInfo{}
+	}
+	return info
+}
+
 // Tester
 
 func NewTester(t *testing.T, r http.Handler, calls ...*Call) *Tester {
@@ -62,9 +143,62 @@ func NewTester(t *testing.T, r http.Handler, calls ...*Call) *Tester {
 		t:      t,
 		r:      r,
 		values: make(Values),
+		rnd:    rand.New(rand.NewSource(defaultSeed)),
 	}
 }
 
+// Seed sets the seed of the random source used by the randInt,
+// randString and uuid templating funcs. The source is seeded with
+// a constant by default, so that the generated values are the same
+// from one run to another.
+func (t *Tester) Seed(seed int64) {
+	t.rnd = rand.New(rand.NewSource(seed))
+}
+
+// CountQueries makes the tester reset qc before each call,
+// and record its count once the call has been served, for use
+// by the ExpectMaxQueries checker.
+func (t *Tester) CountQueries(qc QueryCounter) {
+	t.queryCounter = qc
+}
+
+// SetBasePath sets a prefix prepended to the path of the calls,
+// e.g. the path an API is mounted on. Calls whose path already
+// starts with the prefix, and absolute URLs, are left untouched.
+func (t *Tester) SetBasePath(prefix string) {
+	t.basePath = strings.TrimSuffix(prefix, "/")
+}
+
+// withBasePath returns the request URI uri prefixed
+// with the base path of the tester, if needed.
+func (t *Tester) withBasePath(uri string) string {
+	if t.basePath == "" || strings.Contains(uri, "://") {
+		return uri
+	}
+	if strings.HasPrefix(uri, t.basePath) {
+		rest := uri[len(t.basePath):]
+		if rest == "" || rest[0] == '/' || rest[0] == '?' {
+			return uri
+		}
+	}
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	return t.basePath + uri
+}
+
+// BeforeEach sets a hook called before each call is sent,
+// e.g. to reset state between calls.
+func (t *Tester) BeforeEach(f func(c Call)) {
+	t.beforeEach = f
+}
+
+// AfterEach sets a hook called after each call, once its
+// response has been checked.
+func (t *Tester) AfterEach(f func(c Call, r *http.Response)) {
+	t.afterEach = f
+}
+
 func (t *Tester) Reset() {
 	t.Calls = []*Call{}
 }
@@ -80,90 +214,225 @@ func (t *Tester) AddCall(name, method, querystr, body string) *Call {
 	return c
 }
 
+// Run executes the calls in order, each in a subtest named after the
+// call, reporting the failures of each call with t.Error.
 func (it *Tester) Run() {
+	it.RunWithRetries(0)
+}
+
+// RunWithRetries executes the calls as Run does, but executes again a
+// call that failed, up to n times, with the before and after hooks,
+// before reporting its failures: only the failures of the last attempt
+// are reported, and a call succeeding after retries is logged.
+// This is meant to tolerate flaky dependencies of integration suites,
+// and should be used sparingly.
+func (it *Tester) RunWithRetries(n int) {
 	for _, c := range it.Calls {
 		it.t.Run(c.Name, func(t *testing.T) {
-			body := bytes.NewBufferString(it.applyTemplate(c.Body))
-			requestURI := it.applyTemplate(c.QueryStr)
-
-			req, err := http.NewRequest(c.Method, requestURI, body)
-			if err != nil {
-				t.Error(err)
-				return
-			}
-
-			// Save unparsed url for http routers whi use it
-			req.RequestURI = requestURI
-
-			if c.Body != "" {
-				req.Header.Set("content-type", "application/json")
-			}
-			if c.headers != nil {
-				for k, v := range c.headers {
-					req.Header.Set(it.applyTemplate(k), it.applyTemplate(v))
+			first := len(it.results)
+			errs := it.runCall(c)
+			for attempt := 1; len(errs) > 0 && attempt <= n; attempt++ {
+				t.Logf("%s: retrying (%d/%d) after %d failures: %v", c.Name, attempt, n, len(errs), errs)
+				errs = it.runCall(c)
+				if len(errs) == 0 {
+					t.Logf("%s: succeeded after %d retries", c.Name, attempt)
 				}
 			}
-			if c.host != "" {
-				req.Host = c.host
-			}
-			w := httptest.NewRecorder()
-			it.r.ServeHTTP(w, req)
-			resp := w.Result()
-			var respBody string
-			if resp.Body != nil {
-				rb, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					t.Error(err)
-				}
-				respBody = string(rb)
-				resp.Body.Close()
-				if c.respObject != nil {
-					err = json.Unmarshal(rb, c.respObject)
-					if err != nil {
-						t.Error(err)
-					}
-				}
-
-				dec := json.NewDecoder(bytes.NewBuffer(rb))
-				dec.UseNumber()
-
-				var retJson interface{}
-				err = dec.Decode(&retJson)
-				if err == nil {
-					it.values[c.Name] = retJson
-				}
+			// Only report the last attempt.
+			if len(it.results) > first+1 {
+				it.results = append(it.results[:first], it.results[len(it.results)-1])
 			}
-			failed := false
-			for _, checker := range c.checkers {
-				err = checker(resp, respBody, c.respObject)
-				if err != nil {
-					t.Errorf("%s: %s", c.Name, err)
-					failed = true
-				}
+			for _, err := range errs {
+				t.Error(err)
 			}
-			if failed && it.Fatal {
+			if len(errs) > 0 && it.Fatal {
 				t.FailNow()
 			}
 		})
 	}
+	if err := it.writeHAR(); err != nil {
+		it.t.Error(err)
+	}
 }
 
-func (t *Tester) applyTemplate(s string) string {
-	b, err := t.values.Apply(s)
+// RunErr executes the calls in order, and returns the failures of
+// the calls instead of reporting them to a *testing.T, for a tester
+// to be used outside of tests, e.g. for smoke tests in a binary
+// (the tester can then be created with a nil *testing.T).
+// If Fatal is set, it stops at the first call that fails.
+func (it *Tester) RunErr() []error {
+	var errs []error
+	for _, c := range it.Calls {
+		callErrs := it.runCall(c)
+		errs = append(errs, callErrs...)
+		if len(callErrs) > 0 && it.Fatal {
+			break
+		}
+	}
+	if err := it.writeHAR(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// runCall executes the call c, and returns its failures.
+func (it *Tester) runCall(c *Call) []error {
+	var errs []error
+	fail := func(err error) {
+		errs = append(errs, fmt.Errorf("%s: %s", c.Name, err))
+	}
+	result := callResult{name: c.Name}
+	callStarted := time.Now()
+	defer func() {
+		result.elapsed = time.Since(callStarted)
+		for _, err := range errs {
+			result.failures = append(result.failures, err.Error())
+		}
+		it.results = append(it.results, result)
+	}()
+	if it.beforeEach != nil {
+		it.beforeEach(*c)
+	}
+	applyTemplate := func(s string) string {
+		b, err := it.values.apply(s, it.rnd)
+		if err != nil {
+			fail(err)
+			return ""
+		}
+		return string(b)
+	}
+	reqBody := applyTemplate(c.Body)
+	body := bytes.NewBufferString(reqBody)
+	requestURI := it.withBasePath(applyTemplate(c.QueryStr))
+
+	req, err := http.NewRequest(c.Method, requestURI, body)
 	if err != nil {
-		t.t.Error(err)
-		return ""
+		fail(err)
+		return errs
+	}
+
+	// Save unparsed url for http routers whi use it
+	req.RequestURI = requestURI
+
+	if c.Body != "" {
+		req.Header.Set("content-type", "application/json")
+	}
+	if c.headers != nil {
+		// Apply the templates in a stable order, for
+		// the random values to be reproducible.
+		keys := make([]string, 0, len(c.headers))
+		for k := range c.headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			req.Header.Set(applyTemplate(k), applyTemplate(c.headers[k]))
+		}
+	}
+	// The auth helpers take precedence over the headers.
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+applyTemplate(c.bearerToken))
+	}
+	if c.basicAuth != nil {
+		req.SetBasicAuth(applyTemplate(c.basicAuth[0]), applyTemplate(c.basicAuth[1]))
+	}
+	if c.host != "" {
+		req.Host = c.host
+	}
+	w := httptest.NewRecorder()
+	info := &callInfo{}
+	if it.queryCounter != nil {
+		it.queryCounter.Reset()
+	}
+	started := time.Now()
+	it.r.ServeHTTP(w, req)
+	elapsed := time.Since(started)
+	info.duration = elapsed
+	if it.queryCounter != nil {
+		info.queries = it.queryCounter.Count()
+		info.queriesCounted = true
+	}
+	resp := w.Result()
+	resp.Request = req.WithContext(context.WithValue(req.Context(), callInfoKey{}, info))
+	var respBody string
+	if resp.Body != nil {
+		rb, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			fail(err)
+		}
+		respBody = string(rb)
+		resp.Body.Close()
+		if c.respObject != nil {
+			err = json.Unmarshal(rb, c.respObject)
+			if err != nil {
+				fail(err)
+			}
+		}
+
+		dec := json.NewDecoder(bytes.NewBuffer(rb))
+		dec.UseNumber()
+
+		var retJson interface{}
+		err = dec.Decode(&retJson)
+		if err == nil {
+			it.values[c.Name] = retJson
+		}
+	}
+	it.values.setHeaders(c.Name, resp.Header)
+	it.recordHAR(c.Name, req, reqBody, resp, respBody, started, elapsed)
+	for _, checker := range c.checkers {
+		err = checker(resp, respBody, c.respObject)
+		if err != nil {
+			fail(err)
+		}
 	}
-	return string(b)
+	if len(errs) == 0 {
+		for _, probe := range c.sideEffects {
+			if err := probe(); err != nil {
+				fail(fmt.Errorf("Side effect: %s", err))
+			}
+		}
+	}
+	if it.afterEach != nil {
+		it.afterEach(*c, resp)
+	}
+	return errs
 }
 
 type Values map[string]interface{}
 
+// headersKey is the reserved key of the Values under which the
+// response headers of the calls are stored, by call name.
+const headersKey = "__headers"
+
+// setHeaders stores the first value of each of the headers h
+// of the response of the call name.
+func (v Values) setHeaders(name string, h http.Header) {
+	all, ok := v[headersKey].(map[string]interface{})
+	if !ok {
+		all = make(map[string]interface{})
+		v[headersKey] = all
+	}
+	headers := make(map[string]string, len(h))
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+	all[name] = headers
+}
+
 func (v Values) Apply(templateStr string) ([]byte, error) {
+	return v.apply(templateStr, rand.New(rand.NewSource(defaultSeed)))
+}
+
+func (v Values) apply(templateStr string, rnd *rand.Rand) ([]byte, error) {
 
 	var funcMap = template.FuncMap{
-		"field": v.fieldTmpl,
-		"json":  v.jsonFieldTmpl,
+		"field":      v.fieldTmpl,
+		"header":     v.headerTmpl,
+		"json":       v.jsonFieldTmpl,
+		"randInt":    randIntTmpl(rnd),
+		"randString": randStringTmpl(rnd),
+		"uuid":       uuidTmpl(rnd),
 	}
 
 	tmpl, err := template.New("tmpl").Funcs(funcMap).Parse(templateStr)
@@ -208,6 +477,12 @@ func (v Values) fieldTmpl(key ...string) (interface{}, error) {
 	return i, nil
 }
 
+// headerTmpl returns the value of the header of the
+// response of the call, e.g. {{header "create" "Location"}}.
+func (v Values) headerTmpl(call, header string) (interface{}, error) {
+	return v.fieldTmpl(headersKey, call, http.CanonicalHeaderKey(header))
+}
+
 func (v Values) jsonFieldTmpl(key ...string) (interface{}, error) {
 	i, err := v.fieldTmpl(key...)
 	if err != nil {
@@ -220,6 +495,43 @@ func (v Values) jsonFieldTmpl(key ...string) (interface{}, error) {
 	return string(marshalled), nil
 }
 
+// randIntTmpl returns a func generating a random integer
+// in [min, max) from rnd.
+func randIntTmpl(rnd *rand.Rand) func(min, max int) (int, error) {
+	return func(min, max int) (int, error) {
+		if max <= min {
+			return 0, fmt.Errorf("randInt: max %d must be greater than min %d", max, min)
+		}
+		return min + rnd.Intn(max-min), nil
+	}
+}
+
+const randStringChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// randStringTmpl returns a func generating a random
+// alphanumeric string of length n from rnd.
+func randStringTmpl(rnd *rand.Rand) func(n int) string {
+	return func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = randStringChars[rnd.Intn(len(randStringChars))]
+		}
+		return string(b)
+	}
+}
+
+// uuidTmpl returns a func generating a random (version 4)
+// UUID from rnd.
+func uuidTmpl(rnd *rand.Rand) func() (string, error) {
+	return func() (string, error) {
+		u, err := uuid.NewRandomFromReader(rnd)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+}
+
 // BUILT IN CHECKERS
 
 func ExpectStatus(st int) Checker {
@@ -314,3 +626,241 @@ func ExpectJSONBranch(nodes ...string) Checker {
 		return nil
 	}
 }
+
+// ExpectEmptyBody checks that the response has no body.
+func ExpectEmptyBody() Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if len(body) != 0 {
+			return fmt.Errorf("Body '%s' should be empty", body)
+		}
+		return nil
+	}
+}
+
+// ExpectNonEmptyBody checks that the response has a body.
+func ExpectNonEmptyBody() Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if len(body) == 0 {
+			return errors.New("Body should not be empty")
+		}
+		return nil
+	}
+}
+
+// ExpectBodySize checks that the body of the response
+// is at most max bytes long.
+func ExpectBodySize(max int) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if len(body) > max {
+			return fmt.Errorf("Body too large: expected at most %d bytes, got %d", max, len(body))
+		}
+		return nil
+	}
+}
+
+// ExpectJSONSchema checks that the JSON body conforms to the given
+// JSON schema document, and reports the violations of the schema.
+// It panics if the schema is invalid.
+func ExpectJSONSchema(schema string) Checker {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("invalid JSON schema: %s", err))
+	}
+	return func(r *http.Response, body string, respObject interface{}) error {
+		result, err := s.Validate(gojsonschema.NewStringLoader(body))
+		if err != nil {
+			return fmt.Errorf("Invalid JSON body: %s", err)
+		}
+		if !result.Valid() {
+			errs := make([]string, 0, len(result.Errors()))
+			for _, e := range result.Errors() {
+				errs = append(errs, e.String())
+			}
+			return fmt.Errorf("Body does not match schema: %s", strings.Join(errs, "; "))
+		}
+		return nil
+	}
+}
+
+// ExpectJSONPath checks that the value at path in the JSON body equals
+// expected, once expected is converted to JSON. The path is a small
+// subset of JSONPath, made of object keys and array indices, with an
+// optional leading $: ".a.b[0].c" or "$.items[2]".
+// Numbers are compared as written, not rounded to float64.
+func ExpectJSONPath(path string, expected interface{}) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		var doc interface{}
+		dec := json.NewDecoder(strings.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		v, err := jsonPath(doc, path)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(expected)
+		if err != nil {
+			return err
+		}
+		var exp interface{}
+		dec = json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&exp); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(v, exp) {
+			got, _ := json.Marshal(v)
+			return fmt.Errorf("Wrong value at '%s': expected '%s', got '%s'", path, b, got)
+		}
+		return nil
+	}
+}
+
+// jsonPath returns the value at path in the decoded JSON document doc.
+func jsonPath(doc interface{}, path string) (interface{}, error) {
+	p := strings.TrimPrefix(path, "$")
+	cur := doc
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			key := p[:end]
+			p = p[end:]
+			if key == "" {
+				return nil, fmt.Errorf("Invalid path '%s': empty key", path)
+			}
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Path '%s' does not resolve: cannot get key '%s' of %T", path, key, cur)
+			}
+			if cur, ok = m[key]; !ok {
+				return nil, fmt.Errorf("Path '%s' does not resolve: missing key '%s'", path, key)
+			}
+		case '[':
+			end := strings.Index(p, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Invalid path '%s': unclosed bracket", path)
+			}
+			idx, err := strconv.Atoi(p[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid path '%s': invalid index '%s'", path, p[1:end])
+			}
+			p = p[end+1:]
+			l, ok := cur.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Path '%s' does not resolve: cannot index %T", path, cur)
+			}
+			if idx < 0 || idx >= len(l) {
+				return nil, fmt.Errorf("Path '%s' does not resolve: index %d out of range (length %d)", path, idx, len(l))
+			}
+			cur = l[idx]
+		default:
+			return nil, fmt.Errorf("Invalid path '%s'", path)
+		}
+	}
+	return cur, nil
+}
+
+// ExpectCookie checks that the response sets the cookie name,
+// and runs validate against it, if not nil.
+func ExpectCookie(name string, validate func(*http.Cookie) error) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		for _, c := range r.Cookies() {
+			if c.Name != name {
+				continue
+			}
+			if validate != nil {
+				if err := validate(c); err != nil {
+					return fmt.Errorf("Cookie '%s': %s", name, err)
+				}
+			}
+			return nil
+		}
+		return fmt.Errorf("Missing expected cookie '%s'", name)
+	}
+}
+
+// ExpectHeader checks that the response has the header name,
+// with exactly the given value.
+func ExpectHeader(name, value string) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		vals, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("Missing expected header '%s'", name)
+		}
+		if len(vals) == 0 || vals[0] != value {
+			return fmt.Errorf("Wrong value for header '%s': expected '%s', got '%s'", name, value, strings.Join(vals, ", "))
+		}
+		return nil
+	}
+}
+
+// ExpectHeaderPresent checks that the response has the header name.
+func ExpectHeaderPresent(name string) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if _, ok := r.Header[http.CanonicalHeaderKey(name)]; !ok {
+			return fmt.Errorf("Missing expected header '%s'", name)
+		}
+		return nil
+	}
+}
+
+// ExpectMaxQueries checks that serving the call issued at most
+// n database queries. It requires a query counter to be installed
+// on the tester with CountQueries.
+func ExpectMaxQueries(n int) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		info := getCallInfo(r)
+		if !info.queriesCounted {
+			return errors.New("No query counter installed on the tester")
+		}
+		if info.queries > n {
+			return fmt.Errorf("Too many queries: expected at most %d, got %d", n, info.queries)
+		}
+		return nil
+	}
+}
+
+// ExpectMaxDuration checks that the call was served within d,
+// measured as the wall time of the ServeHTTP call of the handler.
+func ExpectMaxDuration(d time.Duration) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if elapsed := getCallInfo(r).duration; elapsed > d {
+			return fmt.Errorf("Call too slow: expected at most %s, took %s", d, elapsed)
+		}
+		return nil
+	}
+}
+
+// Not inverts the result of the given checker: it fails when
+// the wrapped checker succeeds, and succeeds when it fails.
+func Not(checker Checker) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		if err := checker(r, body, respObject); err != nil {
+			return nil
+		}
+		return errors.New("Expected checker to fail, but it succeeded")
+	}
+}
+
+// ExpectAnyOf succeeds if any of the given checkers succeeds, e.g. to
+// accept several valid bodies for a non-deterministic output. When
+// none succeeds, it reports the failures of all the checkers.
+func ExpectAnyOf(checkers ...Checker) Checker {
+	return func(r *http.Response, body string, respObject interface{}) error {
+		errs := make([]string, 0, len(checkers))
+		for _, checker := range checkers {
+			err := checker(r, body, respObject)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("Expected any checker to succeed, but all failed: %s", strings.Join(errs, "; "))
+	}
+}
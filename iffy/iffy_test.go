@@ -1,13 +1,24 @@
 package iffy_test
 
 import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-gorp/gorp"
 	"github.com/loopfz/gadgeto/iffy"
 	"github.com/loopfz/gadgeto/tonic"
+	"github.com/loopfz/gadgeto/zesty"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 func helloHandler(c *gin.Context) (interface{}, error) {
@@ -46,3 +57,674 @@ func Test_Tester_Run(t *testing.T) {
 
 	tester.Run()
 }
+
+func Test_Not(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.GET("/hello", tonic.Handler(helloHandler, 200))
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("not-status", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(200), iffy.Not(iffy.ExpectStatus(400)))
+	tester.AddCall("not-field", "GET", "/hello?who=world", "").Checkers(iffy.Not(iffy.ExpectJSONFields("debug")))
+
+	tester.Run()
+
+	notStatus := iffy.Not(iffy.ExpectStatus(200))
+	if err := notStatus(&http.Response{StatusCode: 200}, "", nil); err == nil {
+		t.Error("Not should fail when the wrapped checker succeeds")
+	}
+}
+
+func Test_Tester_RecordHAR(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.GET("/hello", tonic.Handler(helloHandler, 200))
+	r.POST("/foo", tonic.Handler(newFoo, 201))
+
+	path := filepath.Join(t.TempDir(), "run.har")
+
+	tester := iffy.NewTester(t, r)
+	tester.RecordHAR(path)
+
+	tester.AddCall("helloworld", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("createfoo", "POST", "/foo", `{"bar": "baz"}`).Checkers(iffy.ExpectStatus(201))
+
+	tester.Run()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	har := struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					Method   string `json:"method"`
+					URL      string `json:"url"`
+					PostData *struct {
+						Text string `json:"text"`
+					} `json:"postData"`
+				} `json:"request"`
+				Response struct {
+					Status  int `json:"status"`
+					Content struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}{}
+	if err := json.Unmarshal(b, &har); err != nil {
+		t.Fatal(err)
+	}
+	entries := har.Log.Entries
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 HAR entries, got %d", len(entries))
+	}
+	if entries[0].Request.URL != "http://localhost/hello?who=world" || entries[0].Response.Content.Text != `{"msg":"world"}` {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Request.Method != "POST" || entries[1].Request.PostData == nil || entries[1].Request.PostData.Text != `{"bar": "baz"}` || entries[1].Response.Status != 201 {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+}
+
+func Test_ExpectMaxQueries(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	dbmap := &gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}
+	counter := &zesty.QueryCounter{}
+	dbmap.TraceOn("", counter)
+	dbp := zesty.NewTempDBProvider(zesty.NewDB(dbmap))
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+	r.GET("/queries", tonic.Handler(func(c *gin.Context) error {
+		for i := 0; i < 3; i++ {
+			if _, err := dbp.DB().SelectInt("SELECT 1"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, 200))
+
+	tester := iffy.NewTester(t, r)
+	tester.CountQueries(counter)
+
+	tester.AddCall("queries-ok", "GET", "/queries", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectMaxQueries(3))
+	tester.AddCall("queries-too-many", "GET", "/queries", "").Checkers(iffy.ExpectStatus(200), iffy.Not(iffy.ExpectMaxQueries(2)))
+
+	tester.Run()
+}
+
+func Test_ExpectCookie(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.POST("/login", tonic.Handler(func(c *gin.Context) error {
+		c.SetCookie("session", "s3cr3t", 3600, "/", "", true, true)
+		return nil
+	}, 204))
+
+	httpOnly := func(c *http.Cookie) error {
+		if !c.HttpOnly || !c.Secure {
+			return fmt.Errorf("expected HttpOnly and Secure flags")
+		}
+		return nil
+	}
+	value := func(c *http.Cookie) error {
+		if c.Value != "other" {
+			return fmt.Errorf("unexpected value %s", c.Value)
+		}
+		return nil
+	}
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("login", "POST", "/login", "").Checkers(iffy.ExpectStatus(204), iffy.ExpectCookie("session", httpOnly), iffy.ExpectCookie("session", nil))
+	tester.AddCall("login-wrong-value", "POST", "/login", "").Checkers(iffy.Not(iffy.ExpectCookie("session", value)))
+	tester.AddCall("login-missing-cookie", "POST", "/login", "").Checkers(iffy.Not(iffy.ExpectCookie("other", nil)))
+
+	tester.Run()
+}
+
+func Test_Tester_Seed(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.GET("/hello", tonic.Handler(helloHandler, 200))
+
+	run := func(seed int64, seeded bool) []string {
+		var msgs []string
+		record := func(r *http.Response, body string, respObject interface{}) error {
+			var out struct {
+				Msg string `json:"msg"`
+			}
+			if err := json.Unmarshal([]byte(body), &out); err != nil {
+				return err
+			}
+			msgs = append(msgs, out.Msg)
+			return nil
+		}
+		tester := iffy.NewTester(t, r)
+		if seeded {
+			tester.Seed(seed)
+		}
+		tester.AddCall("rand-int", "GET", "/hello?who={{randInt 10 20}}", "").Checkers(iffy.ExpectStatus(200), record)
+		tester.AddCall("rand-string", "GET", "/hello?who={{randString 12}}", "").Checkers(iffy.ExpectStatus(200), record)
+		tester.AddCall("uuid", "GET", "/hello?who={{uuid}}", "").Checkers(iffy.ExpectStatus(200), record)
+		tester.Run()
+		return msgs
+	}
+
+	first, second := run(0, false), run(0, false)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("unseeded runs should be deterministic: %v != %v", first, second)
+	}
+	if len(first) != 3 || len(first[1]) != 12 || len(first[2]) != 36 {
+		t.Errorf("unexpected generated values: %v", first)
+	}
+	seeded := run(42, true)
+	if fmt.Sprint(seeded) != fmt.Sprint(run(42, true)) {
+		t.Error("runs with the same seed should generate the same values")
+	}
+	if fmt.Sprint(seeded) == fmt.Sprint(first) {
+		t.Error("runs with different seeds should generate different values")
+	}
+}
+
+func Test_Tester_BeforeAfterEach(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	counter := 0
+	r.GET("/hello", tonic.Handler(func(c *gin.Context) (interface{}, error) {
+		counter++
+		return &struct {
+			Count int `json:"count"`
+		}{Count: counter}, nil
+	}, 200))
+
+	var events []string
+	tester := iffy.NewTester(t, r)
+	tester.BeforeEach(func(c iffy.Call) {
+		counter = 0
+		events = append(events, "before "+c.Name)
+	})
+	tester.AfterEach(func(c iffy.Call, r *http.Response) {
+		events = append(events, fmt.Sprintf("after %s %d", c.Name, r.StatusCode))
+	})
+
+	tester.AddCall("first", "GET", "/hello", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("count", "1"))
+	tester.AddCall("second", "GET", "/hello", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("count", "1"))
+
+	tester.Run()
+
+	expected := "[before first after first 200 before second after second 200]"
+	if fmt.Sprint(events) != expected {
+		t.Errorf("unexpected hook events %v, expected %s", events, expected)
+	}
+}
+
+func Test_Tester_SetBasePath(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	api := r.Group("/api/v1")
+	api.GET("/hello", tonic.Handler(helloHandler, 200))
+	r.GET("/api/v10/hello", tonic.Handler(helloHandler, 200))
+
+	tester := iffy.NewTester(t, r)
+	tester.SetBasePath("/api/v1/")
+
+	tester.AddCall("relative", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("msg", "world"))
+	tester.AddCall("no-slash", "GET", "hello?who=world", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("already-prefixed", "GET", "/api/v1/hello?who=world", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("prefix-boundary", "GET", "/api/v10/hello?who=world", "").Checkers(iffy.ExpectStatus(404))
+
+	tester.Run()
+}
+
+func Test_Tester_WriteJUnit(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.GET("/hello", tonic.Handler(helloHandler, 200))
+	r.POST("/foo", tonic.Handler(newFoo, 201))
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("helloworld", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("createfoo", "POST", "/foo", `{"bar": "baz"}`).Checkers(iffy.ExpectStatus(201))
+
+	tester.Run()
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := tester.WriteJUnit(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := struct {
+		Name      string `xml:"name,attr"`
+		Tests     int    `xml:"tests,attr"`
+		Failures  int    `xml:"failures,attr"`
+		TestCases []struct {
+			Name      string    `xml:"name,attr"`
+			ClassName string    `xml:"classname,attr"`
+			Time      string    `xml:"time,attr"`
+			Failure   *struct{} `xml:"failure"`
+		} `xml:"testcase"`
+	}{}
+	if err := xml.Unmarshal(b, &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != t.Name() || suite.Tests != 2 || suite.Failures != 0 || len(suite.TestCases) != 2 {
+		t.Fatalf("unexpected test suite: %s", b)
+	}
+	for i, name := range []string{"helloworld", "createfoo"} {
+		tc := suite.TestCases[i]
+		if tc.Name != name || tc.ClassName != t.Name() || tc.Time == "" || tc.Failure != nil {
+			t.Errorf("unexpected test case %+v", tc)
+		}
+	}
+}
+
+func Test_ExpectHeader(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	r.GET("/headers", func(c *gin.Context) {
+		c.Header("X-Request-Id", "42")
+		c.JSON(200, gin.H{"foo": "bar"})
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("headers", "GET", "/headers", "").Checkers(
+		iffy.ExpectStatus(200),
+		iffy.ExpectHeader("Content-Type", "application/json; charset=utf-8"),
+		iffy.ExpectHeader("x-request-id", "42"),
+		iffy.ExpectHeaderPresent("X-Request-Id"),
+		iffy.Not(iffy.ExpectHeader("X-Request-Id", "43")),
+		iffy.Not(iffy.ExpectHeader("Content-Type", "application/json")),
+		iffy.Not(iffy.ExpectHeaderPresent("X-Missing")),
+	)
+
+	tester.Run()
+
+	err := iffy.ExpectHeader("X-Request-Id", "43")(&http.Response{Header: http.Header{"X-Request-Id": {"42"}}}, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "got '42'") {
+		t.Errorf("error should include the actual value: %v", err)
+	}
+}
+
+func Test_Tester_HeaderTemplate(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	r.POST("/resource", func(c *gin.Context) {
+		c.Header("Location", "/resource/42")
+		c.Status(201)
+	})
+	r.GET("/resource/:id", func(c *gin.Context) {
+		c.JSON(200, gin.H{"id": c.Param("id")})
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("create", "POST", "/resource", "").Checkers(iffy.ExpectStatus(201))
+	tester.AddCall("get", "GET", `{{header "create" "location"}}`, "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("id", "42"))
+	tester.AddCall("get-field", "GET", `{{field "__headers" "create" "Location"}}`, "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("id", "42"))
+
+	tester.Run()
+}
+
+func Test_ExpectJSONPath(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	r.GET("/order", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"id": 42,
+			"customer": gin.H{
+				"name":    "foo",
+				"address": gin.H{"city": "Paris"},
+			},
+			"items": []gin.H{
+				{"ref": "a", "quantity": 1},
+				{"ref": "b", "quantity": 3, "tags": []string{"x", "y"}},
+			},
+		})
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("order", "GET", "/order", "").Checkers(
+		iffy.ExpectJSONPath(".id", 42),
+		iffy.ExpectJSONPath("$.customer.address.city", "Paris"),
+		iffy.ExpectJSONPath(".items[1].quantity", 3),
+		iffy.ExpectJSONPath(".items[1].tags", []string{"x", "y"}),
+		iffy.ExpectJSONPath(".items[0]", map[string]interface{}{"ref": "a", "quantity": 1}),
+		iffy.Not(iffy.ExpectJSONPath(".items[0].ref", "b")),
+	)
+
+	tester.Run()
+
+	resp := &http.Response{}
+	body := `{"items": [{"ref": "a"}]}`
+	for path, msg := range map[string]string{
+		".items[0].name": "missing key 'name'",
+		".items[1]":      "index 1 out of range",
+		".items.ref":     "cannot get key 'ref'",
+		".items[0][0]":   "cannot index",
+		".items[a]":      "invalid index",
+	} {
+		err := iffy.ExpectJSONPath(path, "a")(resp, body, nil)
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", path, msg, err)
+		}
+	}
+	err := iffy.ExpectJSONPath(".items[0].ref", "b")(resp, body, nil)
+	if err == nil || !strings.Contains(err.Error(), `expected '"b"', got '"a"'`) {
+		t.Errorf("unexpected mismatch error %v", err)
+	}
+
+	// Large integers must not be rounded to float64.
+	body = `{"id": 9007199254740993}`
+	if err := iffy.ExpectJSONPath(".id", int64(9007199254740993))(resp, body, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := iffy.ExpectJSONPath(".id", int64(9007199254740992))(resp, body, nil); err == nil {
+		t.Error("expected a mismatch error for a large integer ID")
+	}
+}
+
+func Test_Tester_RunErr(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	r.GET("/hello", tonic.Handler(helloHandler, 200))
+
+	// The tester does not need a *testing.T.
+	tester := iffy.NewTester(nil, r)
+
+	tester.AddCall("helloworld", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONFields("msg"))
+	tester.AddCall("badstatus", "GET", "/hello?who=world", "").Checkers(iffy.ExpectStatus(201), iffy.ExpectJSONFields("foo"))
+	tester.AddCall("badhello", "GET", "/hello", "").Checkers(iffy.ExpectStatus(200))
+
+	errs := tester.RunErr()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "badstatus: Bad status code") || !strings.HasPrefix(errs[2].Error(), "badhello: ") {
+		t.Errorf("errors should be prefixed with the name of the call: %v", errs)
+	}
+
+	// Stop at the first call that fails.
+	tester.Fatal = true
+	if errs := tester.RunErr(); len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+}
+
+func Test_Tester_RunWithRetries(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	calls := 0
+	r.GET("/flaky", func(c *gin.Context) {
+		calls++
+		if calls < 3 {
+			c.Status(503)
+			return
+		}
+		c.Status(200)
+	})
+
+	tester := iffy.NewTester(t, r)
+	before := 0
+	tester.BeforeEach(func(c iffy.Call) { before++ })
+
+	tester.AddCall("flaky", "GET", "/flaky", "").Checkers(iffy.ExpectStatus(200))
+
+	tester.RunWithRetries(2)
+
+	if calls != 3 || before != 3 {
+		t.Errorf("expected 3 attempts with hooks, got %d calls and %d hooks", calls, before)
+	}
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := tester.WriteJUnit(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "<testcase") != 1 || strings.Contains(string(b), "<failure") {
+		t.Errorf("only the last attempt should be reported: %s", b)
+	}
+}
+
+func Test_ExpectMaxDuration(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/fast", func(c *gin.Context) { c.Status(200) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+		c.Status(200)
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("fast", "GET", "/fast", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectMaxDuration(time.Second))
+	tester.AddCall("slow", "GET", "/slow", "").Checkers(iffy.ExpectStatus(200), iffy.Not(iffy.ExpectMaxDuration(10*time.Millisecond)))
+
+	tester.Run()
+}
+
+func Test_Tester_Auth(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	r.POST("/login", func(c *gin.Context) {
+		user, pass, ok := c.Request.BasicAuth()
+		if !ok || user != "admin" || pass != "s3cr3t" {
+			c.Status(401)
+			return
+		}
+		c.JSON(200, gin.H{"token": "t0k3n"})
+	})
+	r.GET("/me", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer t0k3n" {
+			c.Status(401)
+			return
+		}
+		c.JSON(200, gin.H{"name": "admin"})
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("login-fail", "POST", "/login", "").BasicAuth("admin", "wrong").Checkers(iffy.ExpectStatus(401))
+	tester.AddCall("login", "POST", "/login", "").BasicAuth("admin", "s3cr3t").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("me", "GET", "/me", "").BearerToken("{{.login.token}}").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONFields("name"))
+	tester.AddCall("me-header", "GET", "/me", "").Headers(iffy.Headers{"Authorization": "Bearer {{.login.token}}"}).Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("me-anonymous", "GET", "/me", "").Checkers(iffy.ExpectStatus(401))
+
+	tester.Run()
+}
+
+func Test_ExpectJSONSchema(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/user", func(c *gin.Context) { c.JSON(200, gin.H{"name": "foo", "age": 42}) })
+	r.GET("/user-invalid", func(c *gin.Context) { c.JSON(200, gin.H{"name": 42}) })
+
+	schema := `{
+		"type": "object",
+		"required": ["name", "age"],
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"}
+		}
+	}`
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("valid", "GET", "/user", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONSchema(schema))
+	tester.AddCall("invalid", "GET", "/user-invalid", "").Checkers(iffy.ExpectStatus(200), iffy.Not(iffy.ExpectJSONSchema(schema)))
+
+	tester.Run()
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/user-invalid", nil))
+	err := iffy.ExpectJSONSchema(schema)(resp.Result(), resp.Body.String(), nil)
+	if err == nil || !strings.Contains(err.Error(), "name") || !strings.Contains(err.Error(), "age") {
+		t.Errorf("expected the violations in the error, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an invalid schema should panic")
+		}
+	}()
+	iffy.ExpectJSONSchema(`{"type": 42}`)
+}
+
+func Test_Call_ExpectSideEffect(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	events := []string{}
+	r.POST("/events/:name", func(c *gin.Context) {
+		events = append(events, c.Param("name"))
+		c.Status(201)
+	})
+
+	published := func(name string) func() error {
+		return func() error {
+			for _, e := range events {
+				if e == name {
+					return nil
+				}
+			}
+			return fmt.Errorf("event %s not published", name)
+		}
+	}
+	probed := false
+
+	tester := iffy.NewTester(nil, r)
+	tester.AddCall("publish", "POST", "/events/foo", "").Checkers(iffy.ExpectStatus(201)).ExpectSideEffect(published("foo"))
+	tester.AddCall("missing", "POST", "/events/bar", "").Checkers(iffy.ExpectStatus(201)).ExpectSideEffect(published("baz"))
+	tester.AddCall("failed", "POST", "/events/bar", "").Checkers(iffy.ExpectStatus(200)).ExpectSideEffect(func() error {
+		probed = true
+		return nil
+	})
+
+	errs := tester.RunErr()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "event baz not published") {
+		t.Errorf("unexpected failures %v", errs)
+	}
+	if probed {
+		t.Error("probes should not run when the checkers fail")
+	}
+}
+
+func Test_ExpectAnyOf(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/set", func(c *gin.Context) { c.String(200, "b,a") })
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("any", "GET", "/set", "").Checkers(iffy.ExpectAnyOf(iffy.ExpectStatus(204), iffy.ExpectStatus(200)))
+	tester.AddCall("none", "GET", "/set", "").Checkers(iffy.Not(iffy.ExpectAnyOf(iffy.ExpectStatus(204), iffy.ExpectStatus(201))))
+
+	tester.Run()
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest("GET", "/set", nil))
+	err := iffy.ExpectAnyOf(iffy.ExpectStatus(204), iffy.ExpectStatus(201))(resp.Result(), resp.Body.String(), nil)
+	if err == nil || !strings.Contains(err.Error(), "204") || !strings.Contains(err.Error(), "201") {
+		t.Errorf("expected the failures of all the checkers, got %v", err)
+	}
+}
+
+func Test_ExpectBody(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/empty", func(c *gin.Context) { c.Status(204) })
+	r.GET("/body", func(c *gin.Context) { c.String(200, "0123456789") })
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("empty", "GET", "/empty", "").Checkers(iffy.ExpectEmptyBody(), iffy.Not(iffy.ExpectNonEmptyBody()), iffy.ExpectBodySize(0))
+	tester.AddCall("body", "GET", "/body", "").Checkers(iffy.ExpectNonEmptyBody(), iffy.Not(iffy.ExpectEmptyBody()), iffy.ExpectBodySize(10), iffy.Not(iffy.ExpectBodySize(9)))
+
+	tester.Run()
+}
+
+func Test_ExpectGolden(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/user", func(c *gin.Context) { c.String(200, `{"name":"foo","age":42,"tags":["a","b"]}`) })
+	r.GET("/user-reordered", func(c *gin.Context) { c.String(200, `{"tags":["a","b"],"age":42,"name":"foo"}`) })
+	r.GET("/user-changed", func(c *gin.Context) { c.String(200, `{"name":"bar","age":42,"tags":["a","b"]}`) })
+	r.GET("/text", func(c *gin.Context) { c.String(200, "hello") })
+	r.GET("/big", func(c *gin.Context) { c.String(200, `{"id":12345678901234567890}`) })
+	r.GET("/big-changed", func(c *gin.Context) { c.String(200, `{"id":12345678901234567891}`) })
+
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "testdata", "user.golden")
+	text := filepath.Join(dir, "testdata", "text.golden")
+	big := filepath.Join(dir, "testdata", "big.golden")
+
+	tester := iffy.NewTester(nil, r)
+	tester.AddCall("missing", "GET", "/user", "").Checkers(iffy.ExpectGolden(golden))
+	if errs := tester.RunErr(); len(errs) != 1 || !strings.Contains(errs[0].Error(), iffy.UpdateGoldenEnv) {
+		t.Errorf("expected a missing golden file error, got %v", errs)
+	}
+
+	t.Setenv(iffy.UpdateGoldenEnv, "1")
+	tester.Reset()
+	tester.AddCall("update", "GET", "/user", "").Checkers(iffy.ExpectGolden(golden))
+	tester.AddCall("updatetext", "GET", "/text", "").Checkers(iffy.ExpectGolden(text))
+	tester.AddCall("updatebig", "GET", "/big", "").Checkers(iffy.ExpectGolden(big))
+	if errs := tester.RunErr(); len(errs) != 0 {
+		t.Fatalf("unexpected failures %v", errs)
+	}
+	b, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\n  \"age\": 42,\n  \"name\": \"foo\",\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n"; string(b) != expected {
+		t.Errorf("unexpected golden file %q", b)
+	}
+
+	t.Setenv(iffy.UpdateGoldenEnv, "")
+	tester.Reset()
+	tester.AddCall("same", "GET", "/user", "").Checkers(iffy.ExpectGolden(golden))
+	tester.AddCall("reordered", "GET", "/user-reordered", "").Checkers(iffy.ExpectGolden(golden))
+	tester.AddCall("text", "GET", "/text", "").Checkers(iffy.ExpectGolden(text))
+	tester.AddCall("big", "GET", "/big", "").Checkers(iffy.ExpectGolden(big))
+	tester.AddCall("changed", "GET", "/user-changed", "").Checkers(iffy.ExpectGolden(golden))
+	tester.AddCall("bigchanged", "GET", "/big-changed", "").Checkers(iffy.ExpectGolden(big))
+	errs := tester.RunErr()
+	if len(errs) != 2 || !strings.Contains(errs[1].Error(), "12345678901234567891") {
+		t.Fatalf("expected two failures, got %v", errs)
+	}
+	if msg := errs[0].Error(); !strings.Contains(msg, `-   "name": "foo",`) || !strings.Contains(msg, `+   "name": "bar",`) || !strings.Contains(msg, `    "age": 42,`) {
+		t.Errorf("expected a diff of the bodies, got %s", msg)
+	}
+}
@@ -0,0 +1,82 @@
+package iffy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// callResult is the outcome of a call, as reported by WriteJUnit.
+type callResult struct {
+	name     string
+	elapsed  time.Duration
+	failures []string
+}
+
+// JUnit XML format, as consumed by most CI servers.
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report of the calls made by Run
+// to a file at path, with a test case for each call: its name,
+// duration, and the errors of its checkers if it failed.
+func (t *Tester) WriteJUnit(path string) error {
+	name := "iffy"
+	if t.t != nil {
+		name = t.t.Name()
+	}
+	suite := junitTestSuite{
+		Name:      name,
+		Tests:     len(t.results),
+		TestCases: []junitTestCase{},
+	}
+	var total time.Duration
+	for _, r := range t.results {
+		total += r.elapsed
+		tc := junitTestCase{
+			Name:      r.name,
+			ClassName: name,
+			Time:      junitSeconds(r.elapsed),
+		}
+		if len(r.failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: r.failures[0],
+				Text:    strings.Join(r.failures, "\n"),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = junitSeconds(total)
+
+	b, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), b...), 0644)
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,147 @@
+package tonic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultAccessLogBodyBytes is the default maximum size of the
+// request and response bodies captured by the AccessLog middleware.
+const DefaultAccessLogBodyBytes = 4 * 1024
+
+// AccessLogOptions configures the AccessLog middleware.
+type AccessLogOptions struct {
+	// Output receives the log entries, one JSON object per line.
+	// It defaults to gin.DefaultWriter.
+	Output io.Writer
+
+	// CaptureBodies enables the capture of the request and
+	// response bodies. The bodies are buffered in memory and
+	// may hold sensitive data: this is meant for debugging,
+	// and should not be enabled in production.
+	CaptureBodies bool
+
+	// MaxBodyBytes is the maximum size of each captured body,
+	// beyond which it is truncated. It defaults to
+	// DefaultAccessLogBodyBytes.
+	MaxBodyBytes int
+}
+
+// AccessLogEntry is the log entry emitted by the AccessLog
+// middleware for each request.
+type AccessLogEntry struct {
+	Time                  time.Time     `json:"time"`
+	Method                string        `json:"method"`
+	Route                 string        `json:"route"`
+	URI                   string        `json:"uri"`
+	Handler               string        `json:"handler"`
+	Status                int           `json:"status"`
+	Latency               time.Duration `json:"latency"`
+	ClientIP              string        `json:"client_ip"`
+	Errors                []string      `json:"errors,omitempty"`
+	RequestBody           string        `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool          `json:"request_body_truncated,omitempty"`
+	ResponseBody          string        `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool          `json:"response_body_truncated,omitempty"`
+}
+
+// AccessLog returns a Gin middleware that emits a structured
+// access log entry for each request, once it has been served.
+// The entry holds the route template of the request, and the
+// name of the tonic handler serving it, if any.
+func AccessLog(opts AccessLogOptions) gin.HandlerFunc {
+	out := opts.Output
+	if out == nil {
+		out = gin.DefaultWriter
+	}
+	maxBytes := opts.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultAccessLogBodyBytes
+	}
+	return func(c *gin.Context) {
+		var reqBody, respBody *limitedBuffer
+		if opts.CaptureBodies {
+			// Capture the request body as it is read
+			// by the handler, and the response body as
+			// it is written.
+			reqBody = &limitedBuffer{max: maxBytes}
+			if c.Request.Body != nil {
+				c.Request.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.TeeReader(c.Request.Body, reqBody), c.Request.Body}
+			}
+			respBody = &limitedBuffer{max: maxBytes}
+			c.Writer = &capturingWriter{ResponseWriter: c.Writer, buf: respBody}
+		}
+		started := time.Now()
+
+		c.Next()
+
+		entry := AccessLogEntry{
+			Time:     started,
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			URI:      c.Request.RequestURI,
+			Handler:  c.HandlerName(),
+			Status:   c.Writer.Status(),
+			Latency:  time.Since(started),
+			ClientIP: c.ClientIP(),
+			Errors:   c.Errors.Errors(),
+		}
+		if r, err := GetRouteByHandler(c.Handler()); err == nil {
+			entry.Handler = r.HandlerNameWithPackage()
+		}
+		if opts.CaptureBodies {
+			entry.RequestBody = reqBody.buf.String()
+			entry.RequestBodyTruncated = reqBody.truncated
+			entry.ResponseBody = respBody.buf.String()
+			entry.ResponseBodyTruncated = respBody.truncated
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		out.Write(append(b, '\n'))
+	}
+}
+
+// limitedBuffer is a writer that buffers at most max bytes,
+// and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if n := lb.max - lb.buf.Len(); n < len(p) {
+		lb.truncated = true
+		if n > 0 {
+			lb.buf.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	return lb.buf.Write(p)
+}
+
+// capturingWriter is a gin.ResponseWriter that copies
+// the response body in buf.
+type capturingWriter struct {
+	gin.ResponseWriter
+	buf *limitedBuffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.buf.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,66 @@
+package tonic_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func TestAccessLog(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := gin.New()
+	g.Use(tonic.AccessLog(tonic.AccessLogOptions{Output: out}))
+	g.POST("/body", tonic.Handler(bodyHandler, 200))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/body?foo=bar", strings.NewReader(`{"param": "foo"}`)))
+
+	var entry tonic.AccessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to unmarshal log entry %q: %s", out.String(), err)
+	}
+	if entry.Method != "POST" || entry.Route != "/body" || entry.URI != "/body?foo=bar" || entry.Status != 200 {
+		t.Errorf("unexpected log entry %+v", entry)
+	}
+	if entry.Handler != "tonic_test.bodyHandler" {
+		t.Errorf("unexpected handler %q", entry.Handler)
+	}
+	if entry.RequestBody != "" || entry.ResponseBody != "" {
+		t.Errorf("bodies should not be captured by default: %+v", entry)
+	}
+}
+
+func TestAccessLogCaptureBodies(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	g := gin.New()
+	g.Use(tonic.AccessLog(tonic.AccessLogOptions{Output: out, CaptureBodies: true, MaxBodyBytes: 24}))
+	g.POST("/body", tonic.Handler(bodyHandler, 200))
+
+	body := `{"param": "foo", "param-optional": "barbarbarbar"}`
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/body", strings.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status code %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "barbarbarbar") {
+		t.Errorf("response body should not be truncated: %s", w.Body.String())
+	}
+
+	var entry tonic.AccessLogEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to unmarshal log entry %q: %s", out.String(), err)
+	}
+	if entry.RequestBody != body[:24] || !entry.RequestBodyTruncated {
+		t.Errorf("unexpected request body %q", entry.RequestBody)
+	}
+	if entry.ResponseBody != w.Body.String()[:24] || !entry.ResponseBodyTruncated {
+		t.Errorf("unexpected response body %q", entry.ResponseBody)
+	}
+}
@@ -0,0 +1,63 @@
+package tonic
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteDebugInfo describes a tonic-enabled route,
+// as listed by the DebugRoutes handler.
+type RouteDebugInfo struct {
+	Method            string `json:"method"`
+	Path              string `json:"path"`
+	Handler           string `json:"handler"`
+	InputType         string `json:"input_type,omitempty"`
+	OutputType        string `json:"output_type,omitempty"`
+	DefaultStatusCode int    `json:"default_status_code"`
+}
+
+// DebugRoutes returns a Gin handler that lists the tonic-enabled
+// routes of the engine as JSON. The list reflects the state of
+// the engine at request time.
+// The handler is meant for development: it responds with a
+// 404 when Gin runs in release mode.
+func DebugRoutes(e *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if gin.Mode() == gin.ReleaseMode {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		infos := make([]RouteDebugInfo, 0)
+		for _, ri := range e.Routes() {
+			r, err := GetRouteByHandler(ri.HandlerFunc)
+			if err != nil {
+				continue
+			}
+			infos = append(infos, RouteDebugInfo{
+				Method:            ri.Method,
+				Path:              ri.Path,
+				Handler:           r.HandlerNameWithPackage(),
+				InputType:         typeName(r.InputType()),
+				OutputType:        typeName(r.OutputType()),
+				DefaultStatusCode: r.GetDefaultStatusCode(),
+			})
+		}
+		sort.Slice(infos, func(i, j int) bool {
+			if infos[i].Path != infos[j].Path {
+				return infos[i].Path < infos[j].Path
+			}
+			return infos[i].Method < infos[j].Method
+		})
+		c.JSON(http.StatusOK, infos)
+	}
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
@@ -0,0 +1,52 @@
+package tonic_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+
+	g := gin.New()
+	g.GET("/path/:param", tonic.Handler(pathHandler, 200))
+	g.POST("/simple", tonic.Handler(simpleHandler, 201))
+	g.GET("/raw", func(c *gin.Context) {})
+	g.GET("/debug/routes", tonic.DebugRoutes(g))
+
+	gin.SetMode(gin.DebugMode)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	if w.Code != 200 {
+		t.Fatalf("unexpected status code %d", w.Code)
+	}
+	var infos []tonic.RouteDebugInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 tonic routes, got %d: %+v", len(infos), infos)
+	}
+	expected := []tonic.RouteDebugInfo{
+		{Method: "GET", Path: "/path/:param", Handler: "tonic_test.pathHandler", InputType: "tonic_test.pathIn", OutputType: "tonic_test.pathIn", DefaultStatusCode: 200},
+		{Method: "POST", Path: "/simple", Handler: "tonic_test.simpleHandler", DefaultStatusCode: 201},
+	}
+	for i, e := range expected {
+		if infos[i] != e {
+			t.Errorf("expected route %+v, got %+v", e, infos[i])
+		}
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	if w.Code != 404 {
+		t.Fatalf("expected routes to be hidden in release mode, got status code %d", w.Code)
+	}
+}
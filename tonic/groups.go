@@ -0,0 +1,198 @@
+package tonic
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tonicGroups = "_tonic_groups"
+
+var (
+	// groupTypes caches whether the types have
+	// fields restricted to groups, by type.
+	groupTypes   = make(map[reflect.Type]bool)
+	groupTypesMu = sync.RWMutex{}
+)
+
+// SetGroups sets the serialization groups of the response of
+// the current request, e.g. from the role of the caller in an
+// authentication middleware.
+// The fields of the output objects with a groups tag are only
+// rendered if one of their groups is active:
+//
+//	type User struct {
+//	    Name  string `json:"name"`
+//	    Email string `json:"email" groups:"admin,support"`
+//	}
+//
+// Fields without groups tag are always rendered, and fields with
+// a groups tag are omitted when no group is active.
+func SetGroups(c *gin.Context, groups ...string) {
+	c.Set(tonicGroups, groups)
+}
+
+// Groups returns the serialization groups of the
+// response of the current request.
+func Groups(c *gin.Context) []string {
+	if g, ok := c.Get(tonicGroups); ok {
+		return g.([]string)
+	}
+	return nil
+}
+
+// filterGroups returns the JSON representation of val, without
+// the fields of its structs not in the given groups. Values of
+// interface type and implementing json.Marshaler are not filtered.
+func filterGroups(val interface{}, groups []string) (interface{}, error) {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return filterGroupsOf(reflect.TypeOf(val), v, groups), nil
+}
+
+func filterGroupsOf(t reflect.Type, v interface{}, groups []string) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return v
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		fields := jsonFields(t)
+		for k, fv := range m {
+			f, ok := fields[k]
+			if !ok {
+				continue
+			}
+			if !inGroups(f, groups) {
+				delete(m, k)
+				continue
+			}
+			m[k] = filterGroupsOf(f.Type, fv, groups)
+		}
+	case reflect.Slice, reflect.Array:
+		if l, ok := v.([]interface{}); ok {
+			for i := range l {
+				l[i] = filterGroupsOf(t.Elem(), l[i], groups)
+			}
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for k := range m {
+				m[k] = filterGroupsOf(t.Elem(), m[k], groups)
+			}
+		}
+	}
+	return v
+}
+
+// inGroups returns whether the field f is rendered
+// with the given groups.
+func inGroups(f reflect.StructField, groups []string) bool {
+	tag := f.Tag.Get(GroupsTag)
+	if tag == "" {
+		return true
+	}
+	for _, g := range strings.Split(tag, ",") {
+		if contains(groups, strings.TrimSpace(g)) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFields returns the fields of the struct type t by name
+// in its JSON representation, fields of the embedded structs
+// included.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		tag := ft.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.SplitN(tag, ",", 2)[0]
+		if ft.Anonymous && name == "" {
+			et := ft.Type
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				embedded = append(embedded, et)
+				continue
+			}
+		}
+		if ft.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = ft.Name
+		}
+		fields[name] = ft
+	}
+	// The fields of the outer struct shadow
+	// the promoted fields.
+	for _, et := range embedded {
+		for name, ft := range jsonFields(et) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+	return fields
+}
+
+// hasGroups returns whether the type t, or the types
+// of its fields, have fields restricted to groups.
+func hasGroups(t reflect.Type) bool {
+	groupTypesMu.RLock()
+	has, ok := groupTypes[t]
+	groupTypesMu.RUnlock()
+	if ok {
+		return has
+	}
+	has = typeHasGroups(t, make(map[reflect.Type]bool))
+
+	groupTypesMu.Lock()
+	groupTypes[t] = has
+	groupTypesMu.Unlock()
+
+	return has
+}
+
+func typeHasGroups(t reflect.Type, visited map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if ft.Tag.Get(GroupsTag) != "" || typeHasGroups(ft.Type, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package tonic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultGzipContentTypes are the media types compressed by
+// the gzip render hook, unless set otherwise.
+var DefaultGzipContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"application/javascript",
+	"image/svg+xml",
+	"text/*",
+}
+
+// GzipRenderHook returns a render hook compressing the responses
+// rendered by next with gzip, when the client accepts it, and the
+// body is at least minBytes long. Error responses are rendered by
+// the render hook too, and are compressed the same way. Responses
+// whose status doesn't allow a body, and empty bodies, are never
+// compressed.
+// Only the responses whose Content-Type matches one of the given
+// media types, which can be ranges such as text/*, are compressed,
+// to not spend time compressing already compressed payloads. With
+// none given, the DefaultGzipContentTypes are compressed.
+//
+//	tonic.SetRenderHook(tonic.GzipRenderHook(tonic.DefaultRenderHook, 1024), "")
+func GzipRenderHook(next RenderHook, minBytes int, contentTypes ...string) RenderHook {
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultGzipContentTypes
+	}
+	return func(c *gin.Context, statusCode int, payload interface{}) {
+		// The response depends on the header for
+		// caches, whether it is compressed or not.
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			next(c, statusCode, payload)
+			return
+		}
+		w := c.Writer
+		bw := &bufferedWriter{ResponseWriter: w}
+		c.Writer = bw
+		next(c, statusCode, payload)
+		c.Writer = w
+
+		if w.Written() || !bodyAllowed(w.Status()) || bw.buf.Len() == 0 || bw.buf.Len() < minBytes ||
+			w.Header().Get("Content-Encoding") != "" || !compressible(w.Header().Get("Content-Type"), contentTypes) {
+			w.WriteHeaderNow()
+			if bw.buf.Len() > 0 {
+				w.Write(bw.buf.Bytes())
+			}
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		gz := gzip.NewWriter(w)
+		gz.Write(bw.buf.Bytes())
+		gz.Close()
+	}
+}
+
+// bufferedWriter buffers the body of a response,
+// for the render hooks to post-process it.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedWriter) WriteString(s string) (int, error) {
+	return bw.buf.WriteString(s)
+}
+
+// compressible returns whether the media type of the
+// Content-Type ct matches one of the media ranges types.
+func compressible(ct string, types []string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if matchMediaType(t, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyAllowed returns whether a response
+// with the status code can have a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// acceptsGzip returns whether the Accept-Encoding header
+// accepts the gzip encoding. An explicit gzip coding takes
+// precedence over the * wildcard.
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(p[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if coding == "gzip" {
+			gzipQ = q
+		} else {
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
@@ -0,0 +1,128 @@
+package tonic_test
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func TestGzipRenderHook(t *testing.T) {
+	defer tonic.SetRenderHook(tonic.GetRenderHook(), "")
+	tonic.SetRenderHook(tonic.GzipRenderHook(tonic.DefaultRenderHook, 256), "")
+
+	large := strings.Repeat("foo", 200)
+	g := gin.New()
+	g.GET("/gzip", tonic.Handler(func(c *gin.Context) (*errorResponse, error) {
+		if c.Query("fail") != "" {
+			return nil, errors.New(large)
+		}
+		if c.Query("small") != "" {
+			return &errorResponse{Message: "foo"}, nil
+		}
+		return &errorResponse{Message: large}, nil
+	}, 200))
+
+	get := func(query, acceptEncoding string) (*httptest.ResponseRecorder, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/gzip"+query, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			return w, w.Body.String()
+		}
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w, string(b)
+	}
+
+	w, body := get("", "deflate, gzip;q=0.8")
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(body, large) {
+		t.Errorf("expected a compressed body, got %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+	w, body = get("?small=true", "gzip")
+	if w.Code != 200 || w.Header().Get("Content-Encoding") != "" || !strings.Contains(body, `"foo"`) {
+		t.Errorf("expected an uncompressed small body, got %d %v %s", w.Code, w.Header(), body)
+	}
+	w, body = get("", "gzip;q=0")
+	if w.Header().Get("Content-Encoding") != "" || !strings.Contains(body, large) {
+		t.Errorf("expected an uncompressed body when gzip is refused, got %v", w.Header())
+	}
+	w, body = get("?fail=true", "gzip")
+	if w.Code == 200 || w.Header().Get("Content-Encoding") != "gzip" || !strings.Contains(body, large) {
+		t.Errorf("expected a compressed error, got %d %v", w.Code, w.Header())
+	}
+	w, _ = get("", "gzip;q=0, *")
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("an explicit gzip;q=0 should take precedence over *, got %v", w.Header())
+	}
+	w, _ = get("", "*")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected a compressed body for *, got %v", w.Header())
+	}
+	w, _ = get("", "")
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected an uncompressed body varying on Accept-Encoding, got %v", w.Header())
+	}
+}
+
+func TestGzipRenderHookNoBody(t *testing.T) {
+	defer tonic.SetRenderHook(tonic.GetRenderHook(), "")
+	tonic.SetRenderHook(tonic.GzipRenderHook(tonic.DefaultRenderHook, 0), "")
+
+	g := gin.New()
+	g.DELETE("/gzip", tonic.Handler(func(c *gin.Context) error {
+		return nil
+	}, 204))
+
+	req := httptest.NewRequest("DELETE", "/gzip", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Code != 204 || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected a Vary header, got %v", w.Header())
+	}
+}
+
+func TestGzipRenderHookContentTypes(t *testing.T) {
+	hook := tonic.GzipRenderHook(func(c *gin.Context, status int, payload interface{}) {
+		c.Data(status, c.Query("ct"), []byte(strings.Repeat("foo", 100)))
+	}, 0, "application/json", "text/*")
+
+	g := gin.New()
+	g.GET("/gzip", func(c *gin.Context) { hook(c, 200, nil) })
+
+	for ct, compressed := range map[string]bool{
+		"application/json; charset=utf-8": true,
+		"text/csv":                        true,
+		"image/png":                       false,
+		"application/gzip":                false,
+	} {
+		req := httptest.NewRequest("GET", "/gzip?ct="+url.QueryEscape(ct), nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if (w.Header().Get("Content-Encoding") == "gzip") != compressed {
+			t.Errorf("%s: expected compressed=%t, got %v", ct, compressed, w.Header())
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package tonic
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"reflect"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -29,8 +34,15 @@ var (
 //
 //  func(*gin.Context) error
 //
+// The handler may also return the HTTP status code of the
+// response, overriding the default status given to Handler:
+//
+//  func(*gin.Context, [input object ptr]) ([output object], int, error)
+//
+// Alternatively, the output object can be a StatusResponse.
+//
 // The wrapping gin-handler will bind the parameters from the query-string,
-// path, body and headers, and handle the errors.
+// path, body, headers, cookies and client IP, and handle the errors.
 //
 // Handler will panic if the tonic handler or its input/output values
 // are of incompatible type.
@@ -45,6 +57,20 @@ func Handler(h interface{}, status int, options ...func(*Route)) gin.HandlerFunc
 
 	in := input(ht, fname)
 	out := output(ht, fname)
+	if in != nil {
+		checkInputFields(in, fname, nil)
+	}
+
+	route := &Route{
+		defaultStatusCode: status,
+		handler:           hv,
+		handlerType:       ht,
+		inputType:         in,
+		outputType:        out,
+	}
+	for _, opt := range options {
+		opt(route)
+	}
 
 	// Wrap Gin handler.
 	f := func(c *gin.Context) {
@@ -63,6 +89,9 @@ func Handler(h interface{}, status int, options ...func(*Route)) gin.HandlerFunc
 			c.Abort()
 			return
 		}
+		if recoverPanics {
+			defer recoverPanic(c, fname)
+		}
 		// funcIn contains the input parameters of the
 		// tonic handler call.
 		args := []reflect.Value{reflect.ValueOf(c)}
@@ -71,43 +100,83 @@ func Handler(h interface{}, status int, options ...func(*Route)) gin.HandlerFunc
 		// binding.
 		if in != nil {
 			input := reflect.New(in)
+			if route.maxBodyBytes > 0 {
+				c.Set(tonicMaxBodyBytes, route.maxBodyBytes)
+			}
+			// Apply the defaults of the body fields
+			// before binding the body, so that the values
+			// it provides, zero values included, prevail.
+			if err := setBodyDefaults(input, nil); err != nil {
+				handleError(c, err)
+				return
+			}
 			// Bind the body with the hook.
 			if err := bindHook(c, input.Interface()); err != nil {
-				handleError(c, BindError{message: err.Error(), typ: in})
+				handleError(c, BindError{message: err.Error(), typ: in, location: bodyLocation, err: err})
 				return
 			}
 			// Bind query-parameters.
-			if err := bind(c, input, QueryTag, extractQuery); err != nil {
+			if err := bind(c, input, tagNames.Query, extractQuery); err != nil {
 				handleError(c, err)
 				return
 			}
 			// Bind path arguments.
-			if err := bind(c, input, PathTag, extractPath); err != nil {
+			if err := bind(c, input, tagNames.Path, extractPath); err != nil {
 				handleError(c, err)
 				return
 			}
 			// Bind headers.
-			if err := bind(c, input, HeaderTag, extractHeader); err != nil {
+			if err := bind(c, input, tagNames.Header, extractHeader); err != nil {
 				handleError(c, err)
 				return
 			}
-			// validating query and path inputs if they have a validate tag
-			initValidator()
-			args = append(args, input)
-			if err := validatorObj.Struct(input.Interface()); err != nil {
-				handleError(c, BindError{message: err.Error(), validationErr: err})
+			// Bind cookies.
+			if err := bind(c, input, CookieTag, extractCookie); err != nil {
+				handleError(c, err)
+				return
+			}
+			// Bind client IP.
+			if err := bind(c, input, ClientIPTag, extractClientIP); err != nil {
+				handleError(c, err)
+				return
+			}
+			// Bind trailers, last: they are only available
+			// once the body has been read entirely.
+			if err := bind(c, input, TrailerTag, extractTrailer); err != nil {
+				handleError(c, err)
 				return
 			}
+			args = append(args, input)
+			// validating query and path inputs if they have a validate tag
+			if !route.skipValidation {
+				initValidator()
+				if err := validatorObj.Struct(input.Interface()); err != nil {
+					handleError(c, BindError{message: err.Error(), typ: in, validationErr: err})
+					return
+				}
+			}
+		}
+		if isDryRun(c) {
+			c.Status(http.StatusNoContent)
+			return
 		}
 		// Call tonic handler with the arguments
 		// and extract the returned values.
 		var err, val interface{}
+		code := status
 
 		ret := hv.Call(args)
-		if out != nil {
+		switch len(ret) {
+		case 3:
+			val = ret[0].Interface()
+			if rc := int(ret[1].Int()); rc != 0 {
+				code = rc
+			}
+			err = ret[2].Interface()
+		case 2:
 			val = ret[0].Interface()
 			err = ret[1].Interface()
-		} else {
+		default:
 			err = ret[0].Interface()
 		}
 		// Handle the error returned by the
@@ -116,19 +185,46 @@ func Handler(h interface{}, status int, options ...func(*Route)) gin.HandlerFunc
 			handleError(c, err.(error))
 			return
 		}
-		renderHook(c, status, val)
+		val, code = unwrapAccepted(c, val, code)
+		val, code = unwrapStatusResponse(val, code)
+
+		if cc, ok := val.(CacheControler); ok && !isNil(val) {
+			c.Header("Cache-Control", cc.CacheControl())
+		} else if route.cacheControl != "" {
+			c.Header("Cache-Control", route.cacheControl)
+		}
+		if hs, ok := val.(HeaderSetter); ok && !isNil(val) {
+			hs.SetHeaders(c.Writer.Header())
+		}
+		if st, ok := streamOf(val); ok {
+			if warnings := Warnings(c); len(warnings) > 0 {
+				warningHook(c, warnings, nil)
+			}
+			stream(c, code, st)
+			return
+		}
+		if !isNil(val) && hasGroups(reflect.TypeOf(val)) {
+			v, err := filterGroups(val, Groups(c))
+			if err != nil {
+				handleError(c, err)
+				return
+			}
+			val = v
+		}
+		if fields := c.Query(SparseFieldsParam); route.sparseFields && fields != "" && !isNil(val) {
+			v, err := filterFields(val, strings.Split(fields, ","))
+			if err != nil {
+				handleError(c, err)
+				return
+			}
+			val = v
+		}
+		if warnings := Warnings(c); len(warnings) > 0 {
+			val = warningHook(c, warnings, val)
+		}
+		renderHook(c, code, val)
 	}
 	// Register route in tonic-enabled routes map
-	route := &Route{
-		defaultStatusCode: status,
-		handler:           hv,
-		handlerType:       ht,
-		inputType:         in,
-		outputType:        out,
-	}
-	for _, opt := range options {
-		opt(route)
-	}
 	routesMu.Lock()
 	routes[fname] = route
 	routesMu.Unlock()
@@ -142,6 +238,16 @@ func Handler(h interface{}, status int, options ...func(*Route)) gin.HandlerFunc
 	return ret
 }
 
+// HandlerG is the type-safe form of Handler for the common handler
+// signature, with an input and an output object: the signature of the
+// handler is checked at compile time rather than when the route is
+// registered. The route is registered like with Handler.
+//
+//  tonic.HandlerG(func(c *gin.Context, in *MyInput) (*MyOutput, error) { ... }, 200)
+func HandlerG[In any, Out any](h func(*gin.Context, *In) (*Out, error), status int, options ...func(*Route)) gin.HandlerFunc {
+	return Handler(h, status, options...)
+}
+
 // RegisterValidation registers a custom validation on the validator.Validate instance of the package
 // NOTE: calling this function may instantiate the validator itself.
 // NOTE: this function is not thread safe, since the validator validation registration isn't
@@ -177,12 +283,26 @@ func initValidator() {
 // the values of the parameters extracted from the Gin context.
 // It reads tag to know what to extract using the extractor func.
 func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error {
+	return bindFields(c, v, tag, extract, make(map[reflect.Type]bool))
+}
+
+// bindFields binds the fields of the struct v, recursing into
+// embedded structs and struct fields holding tagged fields.
+// The types being walked are tracked in visited to avoid an
+// infinite recursion on self-referential types.
+func bindFields(c *gin.Context, v reflect.Value, tag string, extract extractor, visited map[reflect.Type]bool) error {
 	t := v.Type()
 
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 		v = v.Elem()
 	}
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
 	for i := 0; i < t.NumField(); i++ {
 		ft := t.Field(i)
 		field := v.Field(i)
@@ -201,7 +321,7 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 					field = field.Addr()
 				}
 			}
-			err := bind(c, field, tag, extract)
+			err := bindFields(c, field, tag, extract, visited)
 			if err != nil {
 				return err
 			}
@@ -209,6 +329,30 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 		}
 		tagValue := ft.Tag.Get(tag)
 		if tagValue == "" {
+			// Untagged struct fields can group the
+			// parameters in sub-structs. Nil pointers
+			// are only allocated if the struct holds
+			// fields with the tag.
+			if ft.PkgPath == "" && isDeepObject(ft.Type) && !visited[indirectType(ft.Type)] && hasTaggedFields(ft.Type, tag, nil) {
+				if field.Kind() == reflect.Ptr && field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				if err := bindFields(c, field, tag, extract, visited); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// Struct fields of the query are bound from
+		// bracketed keys, in deep-object style.
+		if tag == tagNames.Query && ft.Tag.Get(QueryParserTag) == "" && isDeepObject(ft.Type) {
+			name, err := ParseTagKey(tagValue)
+			if err != nil {
+				return BindError{field: ft.Name, typ: t, location: tag, message: err.Error(), err: err}
+			}
+			if err := bindDeepObject(c.Request.URL.Query(), name, field); err != nil {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: err.Error(), err: err}
+			}
 			continue
 		}
 		// Set-up context for extractors.
@@ -219,13 +363,16 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 				c.Set(ExplodeTag, false)
 			}
 		}
-		_, fieldValues, err := extract(c, tagValue)
+		// Delimiter of the values of a non-exploded
+		// query parameter.
+		c.Set(DelimiterTag, ft.Tag.Get(DelimiterTag))
+		name, fieldValues, err := extract(c, tagValue)
 		if err != nil {
-			return BindError{field: ft.Name, typ: t, message: err.Error()}
+			return BindError{field: ft.Name, typ: t, location: tag, param: name, message: err.Error(), err: err}
 		}
 		// Extract default value and use it in place
 		// if no values were returned.
-		def, ok := ft.Tag.Lookup(DefaultTag)
+		def, ok := ft.Tag.Lookup(tagNames.Default)
 		if ok && len(fieldValues) == 0 {
 			if c.GetBool(ExplodeTag) {
 				fieldValues = append(fieldValues, strings.Split(def, ",")...)
@@ -236,6 +383,25 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 		if len(fieldValues) == 0 {
 			continue
 		}
+		// Query parameters referencing a query parser
+		// are bound by the parser, from the raw values.
+		if pn := ft.Tag.Get(QueryParserTag); tag == tagNames.Query && pn != "" {
+			parser, ok := getQueryParser(pn)
+			if !ok {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: fmt.Sprintf("unknown query parser %s", pn)}
+			}
+			pv, err := parser(fieldValues, field.Type())
+			if err != nil {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, value: strings.Join(fieldValues, ","), message: err.Error(), err: err}
+			}
+			if !pv.IsValid() || !pv.Type().AssignableTo(field.Type()) {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: fmt.Sprintf(
+					"query parser %s returned a value not assignable to %s", pn, field.Type()),
+				}
+			}
+			field.Set(pv)
+			continue
+		}
 		// If the field is a nil pointer to a concrete type,
 		// create a new addressable value for this type.
 		if field.Kind() == reflect.Ptr && field.IsNil() {
@@ -248,20 +414,65 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 		}
 		kind := field.Kind()
 
+		// Check the values against the pattern
+		// of the field, if any.
+		if pattern := ft.Tag.Get(PatternTag); pattern != "" {
+			re, err := getPattern(pattern)
+			if err != nil {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: err.Error(), err: err}
+			}
+			for _, fv := range fieldValues {
+				if !re.MatchString(fv) {
+					return BindError{field: ft.Name, typ: t, location: tag, param: name, value: fv, message: fmt.Sprintf(
+						"parameter does not match the pattern %s", pattern),
+					}
+				}
+			}
+		}
+		// Handle enum values. Each value of a
+		// multi-valued parameter is checked.
+		enum := ft.Tag.Get(EnumTag)
+		if enum != "" {
+			enumValues := strings.Split(strings.TrimSpace(enum), ",")
+			for i := range enumValues {
+				enumValues[i] = strings.TrimSpace(enumValues[i])
+			}
+			if len(enumValues) != 0 {
+				for _, fv := range fieldValues {
+					if !enumContains(field.Type(), enumValues, fv) {
+						return BindError{field: ft.Name, typ: t, location: tag, param: name, value: fv, message: fmt.Sprintf(
+							"parameter has not an acceptable value, %s=%v", EnumTag, enumValues),
+						}
+					}
+				}
+			}
+		}
+		// Types with a registered binder are scalars,
+		// whatever their underlying kind.
+		if _, ok := getBinder(field.Type()); ok {
+			kind = reflect.Invalid
+		}
 		// Multiple values can only be filled to types
 		// Slice and Array.
 		if len(fieldValues) > 1 && (kind != reflect.Slice && kind != reflect.Array) {
-			return BindError{field: ft.Name, typ: t, message: "multiple values not supported"}
+			return BindError{field: ft.Name, typ: t, location: tag, param: name, message: "multiple values not supported"}
 		}
 		// Ensure that the number of values to fill does
 		// not exceed the length of a field of type Array.
 		if kind == reflect.Array {
 			if field.Len() != len(fieldValues) {
-				return BindError{field: ft.Name, typ: t, message: fmt.Sprintf(
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: fmt.Sprintf(
 					"parameter expect %d values, got %d", field.Len(), len(fieldValues)),
 				}
 			}
 		}
+		// Ensure that the number of values of a
+		// multi-valued parameter is within bounds.
+		if kind == reflect.Slice {
+			if err := checkItems(ft, len(fieldValues)); err != nil {
+				return BindError{field: ft.Name, typ: t, location: tag, param: name, message: err.Error(), err: err}
+			}
+		}
 		if kind == reflect.Slice || kind == reflect.Array {
 			// Create a new slice with an adequate
 			// length to set all the values.
@@ -272,7 +483,7 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 				v := reflect.New(field.Type().Elem()).Elem()
 				err = bindStringValue(val, v)
 				if err != nil {
-					return BindError{field: ft.Name, typ: t, message: err.Error()}
+					return BindError{field: ft.Name, typ: t, location: tag, param: name, value: val, message: err.Error(), err: err}
 				}
 				if kind == reflect.Slice {
 					field.Set(reflect.Append(field, v))
@@ -283,27 +494,210 @@ func bind(c *gin.Context, v reflect.Value, tag string, extract extractor) error
 			}
 			continue
 		}
-		// Handle enum values.
-		enum := ft.Tag.Get(EnumTag)
-		if enum != "" {
-			enumValues := strings.Split(strings.TrimSpace(enum), ",")
-			if len(enumValues) != 0 {
-				if !contains(enumValues, fieldValues[0]) {
-					return BindError{field: ft.Name, typ: t, message: fmt.Sprintf(
-						"parameter has not an acceptable value, %s=%v", EnumTag, enumValues),
+		// Fill string value into input field.
+		err = bindStringValue(fieldValues[0], field)
+		if err != nil {
+			return BindError{field: ft.Name, typ: t, location: tag, param: name, value: fieldValues[0], message: err.Error(), err: err}
+		}
+	}
+	return nil
+}
+
+// getPattern returns the compiled regular expression of the
+// pattern tag p, compiling it on first use, when the handlers
+// using it are created.
+func getPattern(p string) (*regexp.Regexp, error) {
+	patternsMu.RLock()
+	re, ok := patterns[p]
+	patternsMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s tag %q: %s", PatternTag, p, err)
+	}
+	patternsMu.Lock()
+	patterns[p] = re
+	patternsMu.Unlock()
+
+	return re, nil
+}
+
+// checkItems checks that n, the number of values of the
+// slice field ft, is within the bounds given by its tags.
+func checkItems(ft reflect.StructField, n int) error {
+	if v, ok := ft.Tag.Lookup(MinItemsTag); ok {
+		min, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag %q: %s", MinItemsTag, v, err)
+		}
+		if n < min {
+			return fmt.Errorf("parameter expect at least %d values, got %d", min, n)
+		}
+	}
+	if v, ok := ft.Tag.Lookup(MaxItemsTag); ok {
+		max, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag %q: %s", MaxItemsTag, v, err)
+		}
+		if n > max {
+			return fmt.Errorf("parameter expect at most %d values, got %d", max, n)
+		}
+	}
+	return nil
+}
+
+// hasTaggedFields returns whether the struct type t, or one of
+// its nested structs, holds fields with the tag.
+func hasTaggedFields(t reflect.Type, tag string, visited map[reflect.Type]bool) bool {
+	t = indirectType(t)
+	if visited == nil {
+		visited = make(map[reflect.Type]bool)
+	}
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if ft.Tag.Get(tag) != "" {
+			return true
+		}
+		if (ft.PkgPath == "" || ft.Anonymous) && isDeepObject(ft.Type) && hasTaggedFields(ft.Type, tag, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// indirectType returns the type pointed to by t,
+// if it is a pointer, or t otherwise.
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// sourceTags returns the tags of the fields bound from
+// the request by tonic, rather than by the bind hook.
+func sourceTags() []string {
+	return []string{tagNames.Query, tagNames.Path, tagNames.Header, CookieTag, ClientIPTag, TrailerTag}
+}
+
+// isBodyField returns whether the field is bound from the
+// body of the request by the bind hook.
+func isBodyField(ft reflect.StructField) bool {
+	for _, tag := range sourceTags() {
+		if ft.Tag.Get(tag) != "" {
+			return false
+		}
+	}
+	return ft.PkgPath == "" || ft.Anonymous
+}
+
+// setBodyDefaults sets the value of the default tag of the body
+// fields of v, recursing into nested structs. Nil pointers to
+// structs are allocated only if their type holds defaults.
+// The types being walked are tracked in visited to avoid an
+// infinite recursion on self-referential types.
+func setBodyDefaults(v reflect.Value, visited map[reflect.Type]bool) error {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	t := v.Type()
+	if visited == nil {
+		visited = make(map[reflect.Type]bool)
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		field := v.Field(i)
+
+		if !isBodyField(ft) {
+			continue
+		}
+		if def, ok := ft.Tag.Lookup(tagNames.Default); ok {
+			if field.Kind() == reflect.Ptr {
+				field.Set(reflect.New(field.Type().Elem()))
+				field = field.Elem()
+			}
+			var err error
+			if field.Kind() == reflect.Slice {
+				values := strings.Split(def, ",")
+				field.Set(reflect.MakeSlice(field.Type(), len(values), len(values)))
+				for j, val := range values {
+					if err = bindStringValue(val, field.Index(j)); err != nil {
+						break
 					}
 				}
+			} else {
+				err = bindStringValue(def, field)
+			}
+			if err != nil {
+				return BindError{field: ft.Name, typ: t, location: bodyLocation, value: def, message: fmt.Sprintf("invalid default value: %s", err), err: err}
 			}
+			continue
 		}
-		// Fill string value into input field.
-		err = bindStringValue(fieldValues[0], field)
-		if err != nil {
-			return BindError{field: ft.Name, typ: t, message: err.Error()}
+		ftyp := ft.Type
+		if ftyp.Kind() == reflect.Ptr {
+			ftyp = ftyp.Elem()
+		}
+		if !isDeepObject(ftyp) || visited[ftyp] || !hasBodyDefaults(ftyp, visited) {
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			if !field.CanSet() {
+				continue
+			}
+			if field.IsNil() {
+				field.Set(reflect.New(ftyp))
+			}
+		} else {
+			if !field.CanAddr() {
+				continue
+			}
+			field = field.Addr()
+		}
+		if err := setBodyDefaults(field, visited); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// hasBodyDefaults returns whether the struct type t, or one
+// of its nested structs, has body fields with a default tag.
+func hasBodyDefaults(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if !isBodyField(ft) {
+			continue
+		}
+		if _, ok := ft.Tag.Lookup(tagNames.Default); ok {
+			return true
+		}
+		ftyp := ft.Type
+		if ftyp.Kind() == reflect.Ptr {
+			ftyp = ftyp.Elem()
+		}
+		if isDeepObject(ftyp) && hasBodyDefaults(ftyp, visited) {
+			return true
+		}
+	}
+	return false
+}
+
 // input checks the input parameters of a tonic handler
 // and return the type of the second parameter, if any.
 func input(ht reflect.Type, name string) reflect.Type {
@@ -337,14 +731,86 @@ func input(ht reflect.Type, name string) reflect.Type {
 	return nil
 }
 
+// checkInputFields checks the tags of the fields of the input
+// type t at registration, walking the embedded structs and the
+// struct fields grouping parameters, as bindFields does.
+func checkInputFields(t reflect.Type, name string, visited map[reflect.Type]bool) {
+	t = indirectType(t)
+	if visited == nil {
+		visited = make(map[reflect.Type]bool)
+	}
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		checkCookieField(ft, name)
+		checkPatternField(ft, name)
+		checkItemsField(ft, name)
+		checkQueryParserField(ft, name)
+
+		if (ft.PkgPath == "" || ft.Anonymous) && isDeepObject(ft.Type) {
+			checkInputFields(ft.Type, name, visited)
+		}
+	}
+}
+
+// checkCookieField ensures that the field ft, if bound
+// from a cookie, is single-valued.
+func checkCookieField(ft reflect.StructField, name string) {
+	if ft.Tag.Get(CookieTag) == "" {
+		return
+	}
+	if typ := indirectType(ft.Type); typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		panic(fmt.Sprintf(
+			"invalid type for cookie field %s of handler %s input: cookies are single-valued, got %v",
+			ft.Name, name, ft.Type,
+		))
+	}
+}
+
+// checkPatternField ensures that the pattern tag
+// of the field ft, if any, compiles.
+func checkPatternField(ft reflect.StructField, name string) {
+	if p := ft.Tag.Get(PatternTag); p != "" {
+		if _, err := getPattern(p); err != nil {
+			panic(fmt.Sprintf("invalid field %s of handler %s input: %s", ft.Name, name, err))
+		}
+	}
+}
+
+// checkItemsField ensures that the bounds of the number of
+// values of the field ft, if any, are integers.
+func checkItemsField(ft reflect.StructField, name string) {
+	for _, tag := range []string{MinItemsTag, MaxItemsTag} {
+		if v, ok := ft.Tag.Lookup(tag); ok {
+			if _, err := strconv.Atoi(v); err != nil {
+				panic(fmt.Sprintf("invalid field %s of handler %s input: invalid %s tag %q: %s", ft.Name, name, tag, v, err))
+			}
+		}
+	}
+}
+
+// checkQueryParserField ensures that the query
+// parser of the field ft, if any, is registered.
+func checkQueryParserField(ft reflect.StructField, name string) {
+	if pn := ft.Tag.Get(QueryParserTag); pn != "" {
+		if _, ok := getQueryParser(pn); !ok {
+			panic(fmt.Sprintf("invalid field %s of handler %s input: unknown query parser %s", ft.Name, name, pn))
+		}
+	}
+}
+
 // output checks the output parameters of a tonic handler
 // and return the type of the return type, if any.
 func output(ht reflect.Type, name string) reflect.Type {
 	n := ht.NumOut()
 
-	if n < 1 || n > 2 {
+	if n < 1 || n > 3 {
 		panic(fmt.Sprintf(
-			"incorrect number of output parameters for handler %s, expected 1 or 2, got %d",
+			"incorrect number of output parameters for handler %s, expected 1, 2 or 3, got %d",
 			name, n,
 		))
 	}
@@ -356,7 +822,15 @@ func output(ht reflect.Type, name string) reflect.Type {
 			name, ht.Out(n-1),
 		))
 	}
-	if n == 2 {
+	// The status code, if any, is the
+	// second output parameter.
+	if n == 3 && ht.Out(1).Kind() != reflect.Int {
+		panic(fmt.Sprintf(
+			"unsupported type for handler %s status code output parameter: expected int, got %v",
+			name, ht.Out(1),
+		))
+	}
+	if n >= 2 {
 		t := ht.Out(0)
 		if t.Kind() == reflect.Ptr {
 			t = t.Elem()
@@ -366,6 +840,16 @@ func output(ht reflect.Type, name string) reflect.Type {
 	return nil
 }
 
+// isDryRun returns whether the request asks for a dry run
+// with the dry-run query parameter.
+func isDryRun(c *gin.Context) bool {
+	if dryRunParam == "" {
+		return false
+	}
+	dryRun, err := strconv.ParseBool(c.Query(dryRunParam))
+	return err == nil && dryRun
+}
+
 // handleError handles any error raised during the execution
 // of the wrapping gin-handler.
 func handleError(c *gin.Context, err error) {
@@ -376,6 +860,213 @@ func handleError(c *gin.Context, err error) {
 	renderHook(c, code, resp)
 }
 
+// unwrapStatusResponse returns the body and status code
+// of val if it is a StatusResponse, or val and code otherwise.
+func unwrapStatusResponse(val interface{}, code int) (interface{}, int) {
+	var sr StatusResponse
+	switch v := val.(type) {
+	case StatusResponse:
+		sr = v
+	case *StatusResponse:
+		if v == nil {
+			return nil, code
+		}
+		sr = *v
+	default:
+		return val, code
+	}
+	if sr.Code != 0 {
+		code = sr.Code
+	}
+	return sr.Body, code
+}
+
+// unwrapAccepted returns the body of val and a 202 status
+// code if it is an Accepted, after setting the Location header
+// of the response, or val and code otherwise.
+func unwrapAccepted(c *gin.Context, val interface{}, code int) (interface{}, int) {
+	var a Accepted
+	switch v := val.(type) {
+	case Accepted:
+		a = v
+	case *Accepted:
+		if v == nil {
+			return val, code
+		}
+		a = *v
+	default:
+		return val, code
+	}
+	if a.Location != "" {
+		c.Header("Location", a.Location)
+	}
+	return a.Body, http.StatusAccepted
+}
+
+// streamOf returns the Stream of val if it is a Stream,
+// or an io.Reader.
+func streamOf(val interface{}) (Stream, bool) {
+	switch v := val.(type) {
+	case Stream:
+		return v, v.Reader != nil
+	case *Stream:
+		if v == nil || v.Reader == nil {
+			return Stream{}, false
+		}
+		return *v, true
+	case io.Reader:
+		if isNil(v) {
+			return Stream{}, false
+		}
+		return Stream{Reader: v}, true
+	}
+	return Stream{}, false
+}
+
+// stream copies the content of the reader of st
+// to the response, with the status code. The response
+// is flushed after each write, for the client to get
+// the events of an event stream as they are read.
+func stream(c *gin.Context, code int, st Stream) {
+	if cl, ok := st.Reader.(io.Closer); ok {
+		defer cl.Close()
+	}
+	ct := st.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	c.Header("Content-Type", ct)
+	c.Status(code)
+	c.Writer.WriteHeaderNow()
+
+	if _, err := io.Copy(flushWriter{c.Writer}, st.Reader); err != nil {
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// flushWriter flushes the response writer
+// after each write.
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.w.Flush()
+	return n, err
+}
+
+// fieldsTree is the tree of the dotted field paths
+// of a sparse fieldset. A nil subtree selects the
+// whole value of the field.
+type fieldsTree map[string]fieldsTree
+
+// filterFields returns the JSON representation of val,
+// filtered to the given field paths.
+func filterFields(val interface{}, fields []string) (interface{}, error) {
+	tree := make(fieldsTree)
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		node := tree
+		parts := strings.Split(f, ".")
+		for i, p := range parts {
+			sub, ok := node[p]
+			if ok && sub == nil {
+				// The whole field is already selected.
+				break
+			}
+			if i == len(parts)-1 {
+				node[p] = nil
+				break
+			}
+			if !ok {
+				sub = make(fieldsTree)
+				node[p] = sub
+			}
+			node = sub
+		}
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return tree.filter(v), nil
+}
+
+func (ft fieldsTree) filter(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(ft))
+		for k, sub := range ft {
+			fv, ok := vv[k]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				ret[k] = fv
+			} else {
+				ret[k] = sub.filter(fv)
+			}
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(vv))
+		for i := range vv {
+			ret[i] = ft.filter(vv[i])
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+// isNil returns whether i is nil or a nil pointer.
+func isNil(i interface{}) bool {
+	if i == nil {
+		return true
+	}
+	v := reflect.ValueOf(i)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// enumContains returns whether the value v of a field of type
+// t is one of the enum values. Values of numeric fields, or of
+// their elements, are compared numerically (01 matches 1).
+func enumContains(t reflect.Type, enumValues []string, v string) bool {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return false
+		}
+		for _, e := range enumValues {
+			if en, err := strconv.ParseFloat(e, 64); err == nil && en == n {
+				return true
+			}
+		}
+		return false
+	}
+	return contains(enumValues, v)
+}
+
 // contains returns whether in contain s.
 func contains(in []string, s string) bool {
 	for _, v := range in {
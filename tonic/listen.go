@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -72,14 +73,23 @@ func ListenAndServe(handler http.Handler, errorHandler func(error), opt ...Liste
 		close(stop)
 	}()
 
-	sig := make(chan os.Signal)
+	sig := make(chan os.Signal, 1)
 
 	if len(listenOpt.Signals) > 0 {
 		signal.Notify(sig, listenOpt.Signals...)
+		defer signal.Stop(sig)
 	}
 
 	select {
 	case <-sig:
+		for _, f := range listenOpt.OnShutdown {
+			f()
+		}
+		// Keep serving while the load balancers
+		// notice that the server is draining.
+		if listenOpt.DrainDelay > 0 {
+			time.Sleep(listenOpt.DrainDelay)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), listenOpt.ShutdownTimeout)
 		defer cancel()
 
@@ -101,6 +111,8 @@ type ListenOpt struct {
 	Server          *http.Server
 	Signals         []os.Signal
 	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	OnShutdown      []func()
 }
 
 type ListenOptFunc func(*ListenOpt) error
@@ -153,3 +165,67 @@ func ShutdownTimeout(t time.Duration) ListenOptFunc {
 		return nil
 	}
 }
+
+// OnShutdown registers a function called when a signal is caught,
+// before the server stops accepting connections, e.g. to fail the
+// readiness checks of the service.
+func OnShutdown(f func()) ListenOptFunc {
+	return func(opt *ListenOpt) error {
+		opt.OnShutdown = append(opt.OnShutdown, f)
+		return nil
+	}
+}
+
+// DrainDelay sets the delay between the call of the OnShutdown
+// functions and the shutdown of the server, during which requests
+// are still served, for the load balancers to stop sending traffic.
+func DrainDelay(t time.Duration) ListenOptFunc {
+	return func(opt *ListenOpt) error {
+		opt.DrainDelay = t
+		return nil
+	}
+}
+
+// Readiness is a readiness flag, which can be served as a
+// readiness check (e.g. on /readyz) with its ServeHTTP method.
+// A Readiness is ready when created.
+type Readiness struct {
+	notReady int32
+}
+
+// NewReadiness returns a ready Readiness flag.
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// SetReady sets the readiness flag.
+func (r *Readiness) SetReady(ready bool) {
+	var v int32
+	if !ready {
+		v = 1
+	}
+	atomic.StoreInt32(&r.notReady, v)
+}
+
+// Ready returns the readiness flag.
+func (r *Readiness) Ready() bool {
+	return atomic.LoadInt32(&r.notReady) == 0
+}
+
+// ServeHTTP implements http.Handler: it responds with a
+// 200 OK when ready, and a 503 Service Unavailable otherwise.
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ShutdownReadiness makes r not ready at the start of the
+// shutdown, while in-flight requests are drained.
+func ShutdownReadiness(r *Readiness) ListenOptFunc {
+	return OnShutdown(func() {
+		r.SetReady(false)
+	})
+}
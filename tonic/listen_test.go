@@ -0,0 +1,71 @@
+//go:build unix
+
+package tonic_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func TestListenAndServeShutdownReadiness(t *testing.T) {
+	// Catch the signal in the test as well, so that it
+	// can't kill the process before ListenAndServe does.
+	caught := make(chan os.Signal, 1)
+	signal.Notify(caught, syscall.SIGUSR1)
+	defer signal.Stop(caught)
+
+	readiness := tonic.NewReadiness()
+	draining := make(chan bool, 1)
+
+	w := httptest.NewRecorder()
+	readiness.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("readiness should be ok before shutdown, got %d", w.Code)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tonic.ListenAndServe(http.NotFoundHandler(), func(err error) { t.Error(err) },
+			tonic.ListenAddr("127.0.0.1:0"),
+			tonic.CatchSignals(syscall.SIGUSR1),
+			tonic.ShutdownReadiness(readiness),
+			tonic.OnShutdown(func() { draining <- readiness.Ready() }),
+			tonic.DrainDelay(10*time.Millisecond),
+		)
+		close(done)
+	}()
+
+	// ListenAndServe registers its signal handler
+	// asynchronously: signal until it shuts down.
+	timeout := time.After(5 * time.Second)
+	for running := true; running; {
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		select {
+		case <-done:
+			running = false
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("server did not shut down")
+		}
+	}
+	select {
+	case ready := <-draining:
+		if ready {
+			t.Error("readiness should be flipped before the other shutdown functions")
+		}
+	default:
+		t.Error("shutdown functions were not called")
+	}
+	w = httptest.NewRecorder()
+	readiness.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness should fail after shutdown, got %d", w.Code)
+	}
+}
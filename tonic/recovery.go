@@ -0,0 +1,64 @@
+package tonic
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+var recoverPanics = false
+
+// PanicError is the error passed to the error hook when a
+// tonic-handler panics, if the recovery is enabled with
+// SetRecoverPanics.
+type PanicError struct {
+	// Value is the value the handler panicked with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine at the
+	// time of the panic. It is logged, and should not be
+	// rendered to the client.
+	Stack []byte
+}
+
+// Error implements the builtin error interface.
+func (pe PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", pe.Value)
+}
+
+// SetRecoverPanics sets whether the wrapping gin-handlers recover
+// the panics of the tonic-handlers. A recovered panic is logged
+// with its stack trace to gin.DefaultErrorWriter, and handled as
+// a PanicError by the error hook, for the response to be rendered
+// like the other errors. It is disabled by default, to leave the
+// panics to the recovery middleware of Gin.
+func SetRecoverPanics(enabled bool) {
+	recoverPanics = enabled
+}
+
+// recoverPanic recovers a panic of the handler fname, and
+// handles it with the error hook.
+// It must be deferred by the wrapping gin-handler.
+func recoverPanic(c *gin.Context, fname string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		// The handler aborts the response on
+		// purpose, leave it to net/http.
+		panic(v)
+	}
+	pe := PanicError{Value: v, Stack: debug.Stack()}
+	fmt.Fprintf(gin.DefaultErrorWriter, "[tonic] panic recovered in %s: %v\n%s\n", fname, v, pe.Stack)
+
+	if c.Writer.Written() {
+		// The response can't be replaced anymore.
+		c.Error(pe)
+		c.Abort()
+		return
+	}
+	handleError(c, pe)
+	c.Abort()
+}
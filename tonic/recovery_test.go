@@ -0,0 +1,69 @@
+package tonic_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func panicHandler(c *gin.Context) error {
+	panic("something went wrong")
+}
+
+func TestRecoverPanics(t *testing.T) {
+	tonic.SetRecoverPanics(true)
+	defer tonic.SetRecoverPanics(false)
+
+	logs := new(bytes.Buffer)
+	defer func(w interface{ Write([]byte) (int, error) }) { gin.DefaultErrorWriter = w }(gin.DefaultErrorWriter)
+	gin.DefaultErrorWriter = logs
+
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+	tonic.SetErrorHook(tonic.DefaultErrorHook)
+
+	g := gin.New()
+	g.GET("/panic", tonic.Handler(panicHandler, 200))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "something went wrong") || strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("the panic should not be rendered to the client: %s", w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "something went wrong") || !strings.Contains(logs.String(), "recovery_test.go") {
+		t.Errorf("the panic should be logged with its stack: %s", logs.String())
+	}
+
+	// The panic goes through the error hook.
+	tonic.SetErrorHook(func(c *gin.Context, err error) (int, interface{}) {
+		var pe tonic.PanicError
+		if errors.As(err, &pe) {
+			return 503, gin.H{"panic": pe.Value}
+		}
+		return 400, nil
+	})
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 503 || !strings.Contains(w.Body.String(), "something went wrong") {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoverPanicsDisabled(t *testing.T) {
+	g := gin.New()
+	g.GET("/panic", tonic.Handler(panicHandler, 200))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("the panic should be left to gin")
+		}
+	}()
+	g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,11 @@ type Route struct {
 	summary           string
 	deprecated        bool
 	tags              []string
+	cacheControl      string
+	maxBodyBytes      int64
+	skipValidation    bool
+	sparseFields      bool
+	responses         map[int]ResponseSpec
 
 	// Handler is the route handler.
 	handler reflect.Value
@@ -49,6 +55,29 @@ func (r *Route) GetSummary() string { return r.summary }
 // GetDefaultStatusCode returns the default status code of the route.
 func (r *Route) GetDefaultStatusCode() int { return r.defaultStatusCode }
 
+// GetCacheControl returns the Cache-Control directive
+// set on successful responses of the route.
+func (r *Route) GetCacheControl() string { return r.cacheControl }
+
+// GetSkipValidation returns whether the validation of the
+// input object of the route is disabled.
+func (r *Route) GetSkipValidation() bool { return r.skipValidation }
+
+// GetSparseFields returns whether the route filters the
+// fields of its output with the fields query parameter.
+func (r *Route) GetSparseFields() bool { return r.sparseFields }
+
+// GetResponses returns the additional responses declared
+// for the route with the Responses option, by status code.
+// The response with the default status code of the route
+// is described by its output type, unless declared.
+func (r *Route) GetResponses() map[int]ResponseSpec { return r.responses }
+
+// GetMaxBodyBytes returns the maximum allowed size of the
+// request body of the route, or 0 if the route uses the
+// limit of the binding hook.
+func (r *Route) GetMaxBodyBytes() int64 { return r.maxBodyBytes }
+
 // GetHandler returns the handler of the route.
 func (r *Route) GetHandler() reflect.Value { return r.handler }
 
@@ -129,3 +158,61 @@ func GetRouteByHandler(h gin.HandlerFunc) (*Route, error) {
 	}
 	return route, nil
 }
+
+// NoMethod returns a Gin handler that sets the Allow header of
+// the 405 Method Not Allowed responses of the engine, listing the
+// methods registered for the path of the request. It is installed
+// with the method-not-allowed handling of the engine enabled:
+//
+//	e.HandleMethodNotAllowed = true
+//	e.NoMethod(tonic.NoMethod(e))
+//
+// The list reflects the state of the engine at request time.
+func NoMethod(e *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		methods := allowedMethods(e.Routes(), c.Request.URL.Path)
+		if len(methods) > 0 {
+			c.Header("Allow", strings.Join(methods, ", "))
+		}
+	}
+}
+
+// allowedMethods returns the sorted methods of the routes
+// whose path pattern matches path.
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	seen := make(map[string]bool)
+	methods := make([]string, 0)
+	for _, ri := range routes {
+		if !seen[ri.Method] && matchRoutePath(ri.Path, path) {
+			seen[ri.Method] = true
+			methods = append(methods, ri.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoutePath returns whether path matches the Gin route
+// pattern, with :param and *catch-all segments.
+func matchRoutePath(pattern, path string) bool {
+	ps := strings.Split(pattern, "/")
+	ss := strings.Split(path, "/")
+	for i, p := range ps {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(ss) {
+			return false
+		}
+		if strings.HasPrefix(p, ":") {
+			if ss[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != ss[i] {
+			return false
+		}
+	}
+	return len(ps) == len(ss)
+}
@@ -1,6 +1,9 @@
 package tonic_test
 
 import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -41,3 +44,97 @@ func TestRoute_GetTags(t *testing.T) {
 		t.Fatalf("expected to have tag='otherTag2', but got tag=%s", tags[0])
 	}
 }
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func TestRoute_GetResponses(t *testing.T) {
+	h := tonic.Handler(bodyHandler, 201,
+		tonic.Responses(map[int]tonic.ResponseSpec{
+			400: {Description: "Invalid body", Body: &errorResponse{}},
+			409: {Description: "Conflict"},
+		}),
+		tonic.Responses(map[int]tonic.ResponseSpec{
+			409: {Description: "Already exists", Headers: []string{"Location"}},
+		}),
+	)
+	r, err := tonic.GetRouteByHandler(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := r.GetDefaultStatusCode(); code != 201 {
+		t.Errorf("expected default status code 201, got %d", code)
+	}
+	responses := r.GetResponses()
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(responses))
+	}
+	if _, ok := responses[400].Body.(*errorResponse); !ok || responses[400].Description != "Invalid body" {
+		t.Errorf("unexpected 400 response %+v", responses[400])
+	}
+	if responses[409].Description != "Already exists" || len(responses[409].Headers) != 1 {
+		t.Errorf("unexpected 409 response %+v", responses[409])
+	}
+
+	r, err = tonic.GetRouteByHandler(tonic.Handler(bodyHandler, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.GetResponses() != nil {
+		t.Errorf("expected no responses, got %+v", r.GetResponses())
+	}
+}
+
+func TestHandlerG(t *testing.T) {
+	h := tonic.HandlerG(func(c *gin.Context, in *bodyIn) (*errorResponse, error) {
+		return &errorResponse{Message: in.Param}, nil
+	}, 201, tonic.Summary("typed"))
+
+	r, err := tonic.GetRouteByHandler(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.InputType() != reflect.TypeOf(bodyIn{}) || r.OutputType() != reflect.TypeOf(errorResponse{}) {
+		t.Errorf("unexpected input and output types %v, %v", r.InputType(), r.OutputType())
+	}
+	if r.GetDefaultStatusCode() != 201 || r.GetSummary() != "typed" {
+		t.Errorf("unexpected route %+v", r)
+	}
+
+	g := gin.New()
+	g.POST("/typed", h)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/typed", strings.NewReader(`{"param": "foo"}`)))
+	if w.Code != 201 || !strings.Contains(w.Body.String(), `"foo"`) {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNoMethod(t *testing.T) {
+	g := gin.New()
+	g.HandleMethodNotAllowed = true
+	g.GET("/path/:param", tonic.Handler(pathHandler, 200))
+	g.DELETE("/path/:param", tonic.Handler(pathHandler, 204))
+	g.PUT("/path/:param", func(c *gin.Context) {})
+	g.POST("/simple", tonic.Handler(simpleHandler, 201))
+	g.GET("/files/*path", func(c *gin.Context) {})
+	g.NoMethod(tonic.NoMethod(g))
+
+	for _, tc := range []struct {
+		method, path, allow string
+	}{
+		{"POST", "/path/foo", "DELETE, GET, PUT"},
+		{"GET", "/simple", "POST"},
+		{"DELETE", "/files/foo/bar", "GET"},
+	} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != 405 {
+			t.Errorf("%s %s: expected status code 405, got %d", tc.method, tc.path, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tc.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tc.method, tc.path, tc.allow, allow)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tonic_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (cr *closeRecorder) Close() error {
+	cr.closed = true
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff}, 1024)
+	body := &closeRecorder{Reader: bytes.NewReader(data)}
+
+	g := gin.New()
+	g.GET("/stream", tonic.Handler(func(c *gin.Context) (*tonic.Stream, error) {
+		return &tonic.Stream{ContentType: "text/event-stream", Reader: strings.NewReader("data: foo\n\n")}, nil
+	}, 200))
+	g.GET("/reader", tonic.Handler(func(c *gin.Context) (io.Reader, error) {
+		tonic.AddWarning(c, "deprecated")
+		return body, nil
+	}, 201))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/stream", nil))
+	if w.Code != 200 || w.Body.String() != "data: foo\n\n" || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected response %d %q %s", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/reader", nil))
+	if w.Code != 201 || !bytes.Equal(w.Body.Bytes(), data) || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Warning") == "" {
+		t.Error("expected the warnings in the headers")
+	}
+	if !body.closed {
+		t.Error("the reader should be closed")
+	}
+}
+
+func TestStreamFlush(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	g := gin.New()
+	g.GET("/events", tonic.Handler(func(c *gin.Context) (*tonic.Stream, error) {
+		return &tonic.Stream{ContentType: "text/event-stream", Reader: pr}, nil
+	}, 200))
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+	// End the stream before closing the server.
+	defer pw.Close()
+
+	go pw.Write([]byte("data: foo\n\n"))
+
+	// Headers and events stay buffered if the
+	// response is not flushed: read asynchronously.
+	event := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/events")
+		if err != nil {
+			event <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		event <- line
+	}()
+	select {
+	case line := <-event:
+		if line != "data: foo\n" {
+			t.Errorf("unexpected event %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first event should be received before the end of the stream")
+	}
+}
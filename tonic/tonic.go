@@ -3,11 +3,16 @@ package tonic
 import (
 	"bytes"
 	"encoding"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,22 +27,37 @@ import (
 // DefaultMaxBodyBytes is the maximum allowed size of a request body in bytes.
 const DefaultMaxBodyBytes = 256 * 1024
 
+// SparseFieldsParam is the query parameter listing the fields
+// of the output of the routes enabling sparse fieldsets.
+const SparseFieldsParam = "fields"
+
 // Fields tags used by tonic.
 const (
-	QueryTag      = "query"
-	PathTag       = "path"
-	HeaderTag     = "header"
-	EnumTag       = "enum"
-	RequiredTag   = "required"
-	DefaultTag    = "default"
-	ValidationTag = "validate"
-	ExplodeTag    = "explode"
+	QueryTag       = "query"
+	PathTag        = "path"
+	HeaderTag      = "header"
+	EnumTag        = "enum"
+	RequiredTag    = "required"
+	DefaultTag     = "default"
+	ValidationTag  = "validate"
+	ExplodeTag     = "explode"
+	DelimiterTag   = "delimiter"
+	QueryParserTag = "queryparser"
+	ClientIPTag    = "clientip"
+	CookieTag      = "cookie"
+	MinItemsTag    = "minitems"
+	MaxItemsTag    = "maxitems"
+	PatternTag     = "pattern"
+	GroupsTag      = "groups"
+	TrailerTag     = "trailer"
 )
 
 const (
 	defaultMediaType    = "application/json"
+	defaultDelimiter    = ","
 	tonicRoutesInfos    = "_tonic_route_infos"
 	tonicWantRouteInfos = "_tonic_want_route_infos"
+	tonicMaxBodyBytes   = "_tonic_max_body_bytes"
 )
 
 var (
@@ -52,8 +72,63 @@ var (
 	routesMu = sync.Mutex{}
 	funcs    = make(map[string]struct{})
 	funcsMu  = sync.Mutex{}
+
+	binders   = make(map[reflect.Type]func(string) (reflect.Value, error))
+	bindersMu = sync.RWMutex{}
+
+	queryParsers   = make(map[string]QueryParser)
+	queryParsersMu = sync.RWMutex{}
+
+	queryCaseInsensitive = false
+
+	dryRunParam = ""
+
+	tagNames = TagConfig{
+		Query:   QueryTag,
+		Path:    PathTag,
+		Header:  HeaderTag,
+		Default: DefaultTag,
+	}
+
+	// patterns caches the regular expressions
+	// of the pattern tags, by pattern.
+	patterns   = make(map[string]*regexp.Regexp)
+	patternsMu = sync.RWMutex{}
+
+	// mediaTypes lists the media types the default render
+	// hook negotiates, in order of preference.
+	mediaTypes = []string{defaultMediaType, "application/xml", "text/xml"}
+	renderers  = map[string]func(*gin.Context, int, interface{}){
+		defaultMediaType:  renderJSON,
+		"application/xml": renderXML,
+		"text/xml":        renderXML,
+	}
+	renderersMu = sync.RWMutex{}
+
+	// bindings are the bindings of the body of the default
+	// binding hook, by media type of the request.
+	bindings = map[string]binding.Binding{
+		defaultMediaType:              binding.JSON,
+		binding.MIMEXML:               binding.XML,
+		binding.MIMEXML2:              binding.XML,
+		binding.MIMEPOSTForm:          binding.FormPost,
+		binding.MIMEMultipartPOSTForm: binding.FormMultipart,
+		"text/x-yaml":                 yamlBinding{},
+		"text/yaml":                   yamlBinding{},
+		"text/yml":                    yamlBinding{},
+		"application/x-yaml":          yamlBinding{},
+		"application/x-yml":           yamlBinding{},
+		"application/yaml":            yamlBinding{},
+		"application/yml":             yamlBinding{},
+	}
+	bindingsMu = sync.RWMutex{}
 )
 
+// ErrUnsupportedMediaType is the error returned by the default binding
+// hook for a request body in a media type without registered binding.
+// The default error hook responds to it with a 415 Unsupported Media Type.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
 // BindHook is the hook called by the wrapping gin-handler when
 // binding an incoming request to the tonic-handler's input object.
 type BindHook func(*gin.Context, interface{}) error
@@ -71,6 +146,12 @@ type RenderHook func(*gin.Context, int, interface{})
 // This lets you deeply inspect custom error types.
 type ErrorHook func(*gin.Context, error) (int, interface{})
 
+// LegacyErrorHook is the former signature of ErrorHook,
+// without the Gin context.
+//
+// Deprecated: use ErrorHook, which gives access to the request.
+type LegacyErrorHook func(error) (int, interface{})
+
 // An ExecHook is the func called to handle a request.
 // The default ExecHook simply calle the wrapping gin-handler
 // with the gin context.
@@ -78,8 +159,21 @@ type ExecHook func(*gin.Context, gin.HandlerFunc, string)
 
 // DefaultErrorHook is the default error hook.
 // It returns a StatusBadRequest with a payload containing
-// the error message.
+// the error message, a StatusUnsupportedMediaType for an
+// ErrUnsupportedMediaType, or a StatusInternalServerError
+// without details for a PanicError.
 func DefaultErrorHook(c *gin.Context, e error) (int, interface{}) {
+	var pe PanicError
+	if errors.As(e, &pe) {
+		return http.StatusInternalServerError, gin.H{
+			"error": http.StatusText(http.StatusInternalServerError),
+		}
+	}
+	if errors.Is(e, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType, gin.H{
+			"error": e.Error(),
+		}
+	}
 	return http.StatusBadRequest, gin.H{
 		"error": e.Error(),
 	}
@@ -87,33 +181,95 @@ func DefaultErrorHook(c *gin.Context, e error) (int, interface{}) {
 
 // DefaultBindingHook is the default binding hook.
 // It uses Gin JSON binding to bind the body parameters of the request
-// to the input object of the handler.
-// Ir teturns an error if Gin binding fails.
+// to the input object of the handler. YAML and XML bodies, URL-encoded
+// and multipart forms, and the media types registered with
+// RegisterBinding, are bound according to the Content-Type of the
+// request: form values and uploaded files (*multipart.FileHeader)
+// are bound to the fields with a 'form' tag. Bodies without a
+// Content-Type are bound as JSON, as are the media types with a
+// +json structured syntax suffix (application/merge-patch+json),
+// unless registered; media types with a +xml suffix are bound as XML.
+// Ir teturns an error if Gin binding fails, or an error wrapping
+// ErrUnsupportedMediaType if the media type of the body has no binding.
 var DefaultBindingHook BindHook = DefaultBindingHookMaxBodyBytes(DefaultMaxBodyBytes)
 
 // DefaultBindingHookMaxBodyBytes returns a BindHook with the default logic, with configurable MaxBodyBytes.
+// The limit set on a route with the MaxBodyBytes option takes precedence.
 func DefaultBindingHookMaxBodyBytes(maxBodyBytes int64) BindHook {
 	return func(c *gin.Context, i interface{}) error {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+		limit := maxBodyBytes
+		if n, ok := c.Get(tonicMaxBodyBytes); ok {
+			limit = n.(int64)
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 		if c.Request.ContentLength == 0 || c.Request.Method == http.MethodGet {
 			return nil
 		}
-		switch c.Request.Header.Get("Content-Type") {
-		case "text/x-yaml", "text/yaml", "text/yml", "application/x-yaml", "application/x-yml", "application/yaml", "application/yml":
-			if err := c.ShouldBindWith(i, yamlBinding{}); err != nil && err != io.EOF {
-				return fmt.Errorf("error parsing request body: %s", err.Error())
-			}
-		default:
-			if err := c.ShouldBindWith(i, binding.JSON); err != nil && err != io.EOF {
-				return fmt.Errorf("error parsing request body: %s", err.Error())
-			}
+		contentType := c.Request.Header.Get("Content-Type")
+		if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = mt
+		} else if contentType == "" {
+			contentType = defaultMediaType
+		}
+		b, ok := getBinding(contentType)
+		if !ok {
+			return fmt.Errorf("%w %s, expected one of: %s", ErrUnsupportedMediaType, contentType, strings.Join(bindingMediaTypes(), ", "))
+		}
+		if err := c.ShouldBindWith(i, b); err != nil && err != io.EOF {
+			return fmt.Errorf("error parsing request body: %w", err)
 		}
 		return nil
 	}
 }
 
+// RegisterBinding registers the binding of the request bodies
+// in the given media type for the default binding hook. It
+// overrides the binding of a media type already registered,
+// JSON included.
+func RegisterBinding(mime string, b binding.Binding) {
+	bindingsMu.Lock()
+	defer bindingsMu.Unlock()
+
+	bindings[mime] = b
+}
+
+// getBinding returns the binding registered for the media type,
+// or the binding of its structured syntax suffix, if any.
+func getBinding(mime string) (binding.Binding, bool) {
+	bindingsMu.RLock()
+	defer bindingsMu.RUnlock()
+
+	if b, ok := bindings[mime]; ok {
+		return b, true
+	}
+	switch {
+	case strings.HasSuffix(mime, "+json"):
+		return binding.JSON, true
+	case strings.HasSuffix(mime, "+xml"):
+		return binding.XML, true
+	}
+	return nil, false
+}
+
+// bindingMediaTypes returns the sorted media
+// types of the registered bindings.
+func bindingMediaTypes() []string {
+	bindingsMu.RLock()
+	defer bindingsMu.RUnlock()
+
+	types := make([]string, 0, len(bindings))
+	for mt := range bindings {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	return types
+}
+
 // DefaultRenderHook is the default render hook.
-// It marshals the payload to JSON, or returns an empty body if the payload is nil.
+// It marshals the payload in the media type negotiated from the
+// Accept header of the request, among JSON, XML and the media
+// types registered with RegisterMediaType, falling back to JSON.
+// It returns an empty body if the payload is nil.
 // If Gin is running in debug mode, the marshalled JSON is indented.
 func DefaultRenderHook(c *gin.Context, statusCode int, payload interface{}) {
 	var status int
@@ -123,16 +279,94 @@ func DefaultRenderHook(c *gin.Context, statusCode int, payload interface{}) {
 		status = statusCode
 	}
 	if payload != nil {
-		if gin.IsDebugging() {
-			c.IndentedJSON(status, payload)
-		} else {
-			c.JSON(status, payload)
-		}
+		negotiateRenderer(c.GetHeader("Accept"))(c, status, payload)
 	} else {
 		c.String(status, "")
 	}
 }
 
+// RegisterMediaType registers the function rendering the payloads
+// of the default render hook in the given media type, when it is
+// accepted by the client. It overrides the renderer of a media type
+// already registered, JSON and XML included.
+func RegisterMediaType(mime string, render func(*gin.Context, int, interface{})) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+
+	if _, ok := renderers[mime]; !ok {
+		mediaTypes = append(mediaTypes, mime)
+	}
+	renderers[mime] = render
+}
+
+func renderJSON(c *gin.Context, status int, payload interface{}) {
+	if gin.IsDebugging() {
+		c.IndentedJSON(status, payload)
+	} else {
+		c.JSON(status, payload)
+	}
+}
+
+// renderXML renders the payload as XML, or as JSON if it can't
+// be marshaled to XML, e.g. the maps of sparse fields outputs,
+// when XML was negotiated from an Accept header such as the one
+// of browsers.
+func renderXML(c *gin.Context, status int, payload interface{}) {
+	b, err := xml.Marshal(payload)
+	if err != nil {
+		renderJSON(c, status, payload)
+		return
+	}
+	c.Data(status, binding.MIMEXML+"; charset=utf-8", b)
+}
+
+// negotiateRenderer returns the renderer of the registered media
+// type with the highest quality in the Accept header, or the
+// JSON renderer if none is acceptable.
+func negotiateRenderer(accept string) func(*gin.Context, int, interface{}) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	var (
+		render  = renderers[defaultMediaType]
+		quality = 0.0
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= quality {
+			continue
+		}
+		for _, m := range mediaTypes {
+			if matchMediaType(mt, m) {
+				render, quality = renderers[m], q
+				break
+			}
+		}
+	}
+	return render
+}
+
+// matchMediaType returns whether the media range r,
+// which may hold wildcards, matches the media type mt.
+func matchMediaType(r, mt string) bool {
+	if r == "*/*" || r == mt {
+		return true
+	}
+	if strings.HasSuffix(r, "/*") {
+		return strings.HasPrefix(mt, strings.TrimSuffix(r, "*"))
+	}
+	return false
+}
+
 // DefaultExecHook is the default exec hook.
 // It simply executes the wrapping gin-handler with
 // the given context.
@@ -148,7 +382,72 @@ func GetRoutes() map[string]*Route {
 // MediaType returns the current media type (MIME)
 // used by the actual render hook.
 func MediaType() string {
-	return defaultMediaType
+	return mediaType
+}
+
+// SetQueryCaseInsensitive sets whether the names of the query
+// parameters are matched case-insensitively (?Page=2 binding a
+// field tagged query:"page"). Parameters whose names differ only
+// by case are then considered as one multi-valued parameter.
+// Matching is case-sensitive by default.
+// It should be called before the handlers serve requests.
+func SetQueryCaseInsensitive(enabled bool) {
+	queryCaseInsensitive = enabled
+}
+
+// SetDryRunParam enables the dry-run mode of the handlers, with the
+// name of the query parameter requesting it, e.g. "dryRun". When the
+// parameter is true (?dryRun=true), the request is bound and validated
+// as usual, but the tonic-handler is not called: valid requests get a
+// 204 No Content, and invalid ones the usual binding errors. This lets
+// clients validate a payload without committing it.
+// An empty name disables the dry-run mode, which is the default.
+// It should be called before the handlers serve requests.
+func SetDryRunParam(name string) {
+	dryRunParam = name
+}
+
+// TagConfig holds the names of the tags of the input
+// fields bound from the query, path and headers of the
+// request, and of their default values.
+type TagConfig struct {
+	Query   string
+	Path    string
+	Header  string
+	Default string
+}
+
+// SetTagNames sets the names of the tags used to bind the input
+// objects, e.g. to avoid clashing with the tags of another library.
+// The names default to the QueryTag, PathTag, HeaderTag and DefaultTag
+// constants. The Default name applies to the default tag and to the
+// inline default option of the other tags (query:"limit,default=10").
+// The other tags, such as the cookie, trailer, enum and explode tags,
+// can't be renamed. It returns an error if a name is empty, or if the
+// names are not distinct.
+// Generators of API documentation, such as swagger generators, must
+// read the names with GetTagNames rather than the constants.
+// It should be called before the handlers are registered.
+func SetTagNames(tc TagConfig) error {
+	names := []string{tc.Query, tc.Path, tc.Header, tc.Default}
+	for i, name := range names {
+		if name == "" {
+			return errors.New("tag names must not be empty")
+		}
+		for _, other := range names[:i] {
+			if name == other {
+				return fmt.Errorf("tag name %q is used more than once", name)
+			}
+		}
+	}
+	tagNames = tc
+	return nil
+}
+
+// GetTagNames returns the names of the tags
+// used to bind the input objects.
+func GetTagNames() TagConfig {
+	return tagNames
 }
 
 // GetErrorHook returns the current error hook.
@@ -164,6 +463,20 @@ func SetErrorHook(eh ErrorHook) {
 	}
 }
 
+// SetErrorHookLegacy sets a hook with the former ErrorHook
+// signature as the default error handling hook.
+// To migrate, add a leading *gin.Context parameter to the hook
+// and register it with SetErrorHook.
+//
+// Deprecated: use SetErrorHook.
+func SetErrorHookLegacy(eh LegacyErrorHook) {
+	if eh != nil {
+		SetErrorHook(func(c *gin.Context, e error) (int, interface{}) {
+			return eh(e)
+		})
+	}
+}
+
 // GetBindHook returns the current bind hook.
 func GetBindHook() BindHook {
 	return bindHook
@@ -207,6 +520,68 @@ func GetExecHook() ExecHook {
 	return execHook
 }
 
+// RegisterBinder registers a function that converts the string
+// representation of a query, path, header or cookie parameter to
+// a value of type t. Registered binders take precedence over the
+// encoding.TextUnmarshaler implementation of a type and the
+// default conversions, and also apply to slices of t.
+//
+// eg. to bind uuid.UUID parameters:
+//
+//	tonic.RegisterBinder(reflect.TypeOf(uuid.UUID{}), func(s string) (reflect.Value, error) {
+//	    u, err := uuid.Parse(s)
+//	    return reflect.ValueOf(u), err
+//	})
+func RegisterBinder(t reflect.Type, fn func(string) (reflect.Value, error)) {
+	bindersMu.Lock()
+	defer bindersMu.Unlock()
+	binders[t] = fn
+}
+
+// getBinder returns the binder registered for type t, if any.
+func getBinder(t reflect.Type) (func(string) (reflect.Value, error), bool) {
+	bindersMu.RLock()
+	defer bindersMu.RUnlock()
+	fn, ok := binders[t]
+	return fn, ok
+}
+
+// QueryParser binds the raw values of a query parameter
+// to a value of type t, the type of the input field.
+type QueryParser func(values []string, t reflect.Type) (reflect.Value, error)
+
+// RegisterQueryParser registers a parser for the query parameters
+// of the fields referencing it by name, with the queryparser tag.
+// The parser receives all the values of the parameter, e.g. to
+// bind repeated parameters in a custom format to a slice of
+// structs. An error returned by the parser fails the binding.
+// The parser must be registered before the handlers using it are
+// created, which panics otherwise.
+//
+// eg. to bind ?filter=status:open&filter=owner:me:
+//
+//	type MyInput struct {
+//	    Filters []Filter `query:"filter" queryparser:"filters"`
+//	}
+//
+//	tonic.RegisterQueryParser("filters", func(values []string, t reflect.Type) (reflect.Value, error) {
+//	    ...
+//	})
+func RegisterQueryParser(name string, parser QueryParser) {
+	queryParsersMu.Lock()
+	defer queryParsersMu.Unlock()
+	queryParsers[name] = parser
+}
+
+// getQueryParser returns the query parser registered
+// with name, if any.
+func getQueryParser(name string) (QueryParser, bool) {
+	queryParsersMu.RLock()
+	defer queryParsersMu.RUnlock()
+	p, ok := queryParsers[name]
+	return p, ok
+}
+
 // Description set the description of a route.
 func Description(s string) func(*Route) {
 	return func(r *Route) {
@@ -235,16 +610,141 @@ func Tags(tags []string) func(*Route) {
 	}
 }
 
+// MaxBodyBytes sets the maximum allowed size of the request
+// body of a route, overriding the limit of the default binding
+// hook. Exceeding the limit fails the binding with an error
+// wrapping a *http.MaxBytesError, that an error hook can map
+// to a 413 Request Entity Too Large.
+func MaxBodyBytes(n int64) func(*Route) {
+	return func(r *Route) {
+		r.maxBodyBytes = n
+	}
+}
+
+// WithoutValidation disables the validation of the input
+// object of a route, e.g. for a PATCH route reusing the input
+// type of a POST route to apply partial updates. The input is
+// still bound and its defaults applied, but the validate tags
+// are ignored: the handler is responsible for checking the
+// fields it updates.
+func WithoutValidation() func(*Route) {
+	return func(r *Route) {
+		r.skipValidation = true
+	}
+}
+
+// ResponseSpec describes a response of a route, for
+// documentation purposes.
+type ResponseSpec struct {
+	// Description is the description of the response.
+	Description string
+	// Body is a value of the type of the body of the
+	// response, if any.
+	Body interface{}
+	// Headers are the names of the headers set on
+	// the response.
+	Headers []string
+}
+
+// Responses declares the responses of a route by status code,
+// in addition to the response with its default status code,
+// e.g. the errors returned by the handler. Several calls merge
+// the responses.
+func Responses(responses map[int]ResponseSpec) func(*Route) {
+	return func(r *Route) {
+		if r.responses == nil {
+			r.responses = make(map[int]ResponseSpec, len(responses))
+		}
+		for code, spec := range responses {
+			r.responses[code] = spec
+		}
+	}
+}
+
+// SparseFields enables sparse fieldsets on a route: when the
+// request lists fields in the SparseFieldsParam query parameter
+// (?fields=id,name), the JSON representation of the output is
+// filtered to these fields. Nested fields are designated with
+// dotted paths (?fields=id,owner.name), and apply to each
+// element of lists.
+func SparseFields() func(*Route) {
+	return func(r *Route) {
+		r.sparseFields = true
+	}
+}
+
+// CacheControl sets the Cache-Control header of the
+// successful responses of a route.
+func CacheControl(directive string) func(*Route) {
+	return func(r *Route) {
+		r.cacheControl = directive
+	}
+}
+
+// CacheControler can be implemented by the output object
+// of a handler to compute the Cache-Control header of the
+// response. It takes precedence over the route directive.
+type CacheControler interface {
+	CacheControl() string
+}
+
+// HeaderSetter can be implemented by the output object of
+// a handler to set headers on a successful response, e.g.
+// Location or ETag. The headers are set before the output
+// object is rendered.
+type HeaderSetter interface {
+	SetHeaders(http.Header)
+}
+
+// StatusResponse can be returned as the output object of
+// a handler to set the status code of the response at
+// runtime. Body is rendered as the response payload.
+// A zero Code falls back to the default status of the route.
+type StatusResponse struct {
+	Code int
+	Body interface{}
+}
+
+// Accepted can be returned as the output object of a handler
+// that starts a long-running operation. It is rendered as a
+// 202 Accepted response, with a Location header to poll the
+// status of the operation, if not empty. Body is optional.
+type Accepted struct {
+	Location string
+	Body     interface{}
+}
+
+// Stream can be returned as the output object of a handler to
+// stream the content of Reader as the response body, with the
+// given content type, instead of rendering it. Reader is closed
+// once streamed if it implements io.Closer. The response is
+// flushed after each read of Reader, e.g. for server-sent
+// events to reach the clients as produced. Output objects
+// implementing io.Reader are streamed the same way, as
+// application/octet-stream.
+type Stream struct {
+	ContentType string
+	Reader      io.Reader
+}
+
 // BindError is an error type returned when tonic fails
 // to bind parameters, to differentiate from errors returned
 // by the handlers.
 type BindError struct {
 	validationErr error
+	err           error
 	message       string
 	typ           reflect.Type
 	field         string
+	location      string
+	param         string
+	value         string
 }
 
+// bodyLocation is the location of the errors
+// binding the body of the request.
+const bodyLocation = "body"
+
 // Error implements the builtin error interface for BindError.
 func (be BindError) Error() string {
 	if be.field != "" && be.typ != nil {
@@ -258,6 +758,43 @@ func (be BindError) Error() string {
 	return fmt.Sprintf("binding error: %s", be.message)
 }
 
+// Unwrap returns the underlying error, if any.
+func (be BindError) Unwrap() error {
+	return be.err
+}
+
+// Field returns the name of the field of the input
+// object that failed to bind, if any.
+func (be BindError) Field() string {
+	return be.field
+}
+
+// Type returns the type of the struct holding the
+// field that failed to bind, if any.
+func (be BindError) Type() reflect.Type {
+	return be.typ
+}
+
+// Location returns the location of the parameter that
+// failed to bind in the request, that is the tag it is
+// bound from (query, path, header, cookie, clientip,
+// trailer) or "body". It is empty for validation errors.
+func (be BindError) Location() string {
+	return be.location
+}
+
+// Param returns the name of the parameter that failed
+// to bind in the request, if any.
+func (be BindError) Param() string {
+	return be.param
+}
+
+// Value returns the raw value of the parameter that
+// failed to bind, if any.
+func (be BindError) Value() string {
+	return be.value
+}
+
 // ValidationErrors returns the errors from the validate process.
 func (be BindError) ValidationErrors() validator.ValidationErrors {
 	switch t := be.validationErr.(type) {
@@ -267,6 +804,137 @@ func (be BindError) ValidationErrors() validator.ValidationErrors {
 	return nil
 }
 
+// FieldError describes the validation failure of a field.
+type FieldError struct {
+	// Path is the path of the field in the representation
+	// of the input, using the json tags of body fields and
+	// the tags of the parameters, with the indices of the
+	// slices, arrays and maps (items[2].name).
+	Path string `json:"path"`
+	// Field is the path of the field in the input struct
+	// (Items[2].Name).
+	Field string `json:"field"`
+	// Tag is the validation tag that failed (required).
+	Tag string `json:"tag"`
+	// Param is the parameter of the tag, if any (10 for max=10).
+	Param string `json:"param,omitempty"`
+}
+
+// FieldErrors returns the errors from the validate process,
+// with the paths of the fields that failed.
+func (be BindError) FieldErrors() []FieldError {
+	verrs := be.ValidationErrors()
+	if verrs == nil {
+		return nil
+	}
+	ret := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		field := fe.StructNamespace()
+		// Trim the name of the input type.
+		if idx := strings.Index(field, "."); idx != -1 {
+			field = field[idx+1:]
+		}
+		ret = append(ret, FieldError{
+			Path:  fieldPath(be.typ, field),
+			Field: field,
+			Tag:   fe.Tag(),
+			Param: fe.Param(),
+		})
+	}
+	return ret
+}
+
+// fieldPath translates the path ns of a field of the struct t,
+// as reported by the validator, to the names of the fields
+// in the request. The embedded structs, whose fields are
+// promoted, are skipped.
+func fieldPath(t reflect.Type, ns string) string {
+	var segs []string
+	for _, seg := range splitNamespace(ns) {
+		name, index := seg, ""
+		if idx := strings.Index(seg, "["); idx != -1 {
+			name, index = seg[:idx], seg[idx:]
+		}
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		embedded := false
+		if t != nil && t.Kind() == reflect.Struct {
+			if sf, ok := t.FieldByName(name); ok {
+				name = requestFieldName(sf)
+				t = sf.Type
+				// Embedded structs named in their json
+				// tag are not promoted.
+				embedded = sf.Anonymous && index == "" && name == sf.Name && indirectType(sf.Type).Kind() == reflect.Struct
+			} else {
+				t = nil
+			}
+		} else {
+			t = nil
+		}
+		// Each index is applied to the element
+		// type of the previous one.
+		for n := strings.Count(index, "["); n > 0 && t != nil; n-- {
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				t = t.Elem()
+			default:
+				t = nil
+			}
+		}
+		if embedded {
+			continue
+		}
+		segs = append(segs, name+index)
+	}
+	return strings.Join(segs, ".")
+}
+
+// splitNamespace splits the namespace ns on the dots
+// outside of brackets, which can hold map keys.
+func splitNamespace(ns string) []string {
+	var segs []string
+	depth, start := 0, 0
+	for i := 0; i < len(ns); i++ {
+		switch ns[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case '.':
+			if depth == 0 {
+				segs = append(segs, ns[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, ns[start:])
+}
+
+// requestFieldName returns the name of the field sf in the
+// request: the name of the parameter it is bound from, or
+// its json name.
+func requestFieldName(sf reflect.StructField) string {
+	for _, tag := range sourceTags() {
+		if v := sf.Tag.Get(tag); v != "" && tag != ClientIPTag {
+			if name, err := ParseTagKey(v); err == nil {
+				return name
+			}
+		}
+	}
+	if v := sf.Tag.Get("json"); v != "" {
+		if name := strings.Split(v, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
 // An extractorFunc extracts data from a gin context according to
 // parameters specified in a field tag.
 type extractor func(*gin.Context, string) (string, []string, error)
@@ -279,7 +947,7 @@ func extractQuery(c *gin.Context, tag string) (string, []string, error) {
 		return "", nil, err
 	}
 	var params []string
-	query := c.Request.URL.Query()[name]
+	query := queryValues(c.Request.URL.Query(), name)
 
 	if c.GetBool(ExplodeTag) {
 		// Delete empty elements so default and required arguments
@@ -292,13 +960,23 @@ func extractQuery(c *gin.Context, tag string) (string, []string, error) {
 			}
 		}
 	} else {
-		splitFn := func(c rune) bool {
-			return c == ','
+		delimiter := c.GetString(DelimiterTag)
+		if delimiter == "" {
+			delimiter = defaultDelimiter
 		}
 		if len(query) > 1 {
-			return name, nil, errors.New("repeating values not supported: use comma-separated list")
+			if delimiter == defaultDelimiter {
+				return name, nil, errors.New("repeating values not supported: use comma-separated list")
+			}
+			return name, nil, fmt.Errorf("repeating values not supported: use %q-separated list", delimiter)
 		} else if len(query) == 1 {
-			params = strings.FieldsFunc(query[0], splitFn)
+			// Drop empty elements, as with exploded
+			// parameters.
+			for _, p := range strings.Split(query[0], delimiter) {
+				if p != "" {
+					params = append(params, p)
+				}
+			}
 		}
 	}
 
@@ -313,6 +991,32 @@ func extractQuery(c *gin.Context, tag string) (string, []string, error) {
 	return name, params, nil
 }
 
+// queryValues returns the values of the query parameter name.
+// If the query is matched case-insensitively, the values of all
+// the parameters matching name are returned, starting with the
+// exact match, then ordered by parameter name.
+func queryValues(query url.Values, name string) []string {
+	if !queryCaseInsensitive {
+		return query[name]
+	}
+	keys := make([]string, 0, 1)
+	for k := range query {
+		if k != name && strings.EqualFold(k, name) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return query[name]
+	}
+	sort.Strings(keys)
+
+	values := append([]string{}, query[name]...)
+	for _, k := range keys {
+		values = append(values, query[k]...)
+	}
+	return values
+}
+
 // extractPath is an extractor that operates on the path
 // parameters of a request.
 func extractPath(c *gin.Context, tag string) (string, []string, error) {
@@ -322,6 +1026,11 @@ func extractPath(c *gin.Context, tag string) (string, []string, error) {
 	}
 	p := c.Param(name)
 
+	// A catch-all parameter matching no segment,
+	// e.g. *path for /files/, has the value "/".
+	if p == "/" && strings.HasSuffix(c.FullPath(), "*"+name) {
+		p = ""
+	}
 	// XXX: deprecated, use of "default" tag is preferred
 	if p == "" && defaultVal != "" {
 		return name, []string{defaultVal}, nil
@@ -330,7 +1039,11 @@ func extractPath(c *gin.Context, tag string) (string, []string, error) {
 	if p == "" && required {
 		return "", nil, fmt.Errorf("missing path parameter: %s", name)
 	}
-
+	// Return no values for an absent parameter,
+	// for the default tag to apply.
+	if p == "" {
+		return name, nil, nil
+	}
 	return name, []string{p}, nil
 }
 
@@ -354,6 +1067,214 @@ func extractHeader(c *gin.Context, tag string) (string, []string, error) {
 	return name, []string{header}, nil
 }
 
+// extractCookie is an extractor that operates on the cookies
+// of a request.
+func extractCookie(c *gin.Context, tag string) (string, []string, error) {
+	name, required, defaultVal, err := parseTagKey(tag)
+	if err != nil {
+		return "", nil, err
+	}
+	var value string
+	if cookie, err := c.Request.Cookie(name); err == nil {
+		value = cookie.Value
+	}
+	// XXX: deprecated, use of "default" tag is preferred
+	if value == "" && defaultVal != "" {
+		return name, []string{defaultVal}, nil
+	}
+	// XXX: deprecated, use of "validate" tag is preferred
+	if required && value == "" {
+		return "", nil, fmt.Errorf("missing cookie parameter: %s", name)
+	}
+	if value == "" {
+		return name, nil, nil
+	}
+	return name, []string{value}, nil
+}
+
+// extractTrailer is an extractor that operates on the trailers
+// of a request. The trailers are only received after the body,
+// so the remainder of the body is read and discarded first.
+func extractTrailer(c *gin.Context, tag string) (string, []string, error) {
+	name, required, defaultVal, err := parseTagKey(tag)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Request.Body != nil {
+		if _, err := io.Copy(io.Discard, c.Request.Body); err != nil {
+			return "", nil, fmt.Errorf("failed to read request body before trailers: %s", err)
+		}
+	}
+	value := c.Request.Trailer.Get(name)
+
+	// XXX: deprecated, use of "default" tag is preferred
+	if value == "" && defaultVal != "" {
+		return name, []string{defaultVal}, nil
+	}
+	// XXX: deprecated, use of "validate" tag is preferred
+	if required && value == "" {
+		return "", nil, fmt.Errorf("missing trailer parameter: %s", name)
+	}
+	if value == "" {
+		return name, nil, nil
+	}
+	return name, []string{value}, nil
+}
+
+// extractClientIP is an extractor that returns the IP of the
+// client, as resolved by gin. The proxy headers are honored
+// according to the trusted proxies settings of the engine.
+func extractClientIP(c *gin.Context, tag string) (string, []string, error) {
+	enabled, err := strconv.ParseBool(tag)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed tag for client ip: %s", err)
+	}
+	if !enabled {
+		return "", nil, nil
+	}
+	ip := c.ClientIP()
+	if ip == "" {
+		return ClientIPTag, nil, nil
+	}
+	return ClientIPTag, []string{ip}, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isDeepObject returns whether a parameter of type t should be
+// bound from bracketed query keys (deep-object style), e.g.
+// sort[field]=name&sort[dir]=asc.
+func isDeepObject(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	if _, ok := getBinder(t); ok {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// bindDeepObject binds the bracketed query parameters prefixed
+// by name to the fields of the struct value v. Nested objects
+// are supported through multiple levels of brackets (a[b][c]).
+func bindDeepObject(query url.Values, name string, v reflect.Value) error {
+	if _, ok := query[name]; ok {
+		return fmt.Errorf("query parameter %s must be an object, use %s[field]=value", name, name)
+	}
+	keys := make([]string, 0)
+	for k := range query {
+		if strings.HasPrefix(k, name+"[") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path, err := parseDeepObjectKey(strings.TrimPrefix(k, name))
+		if err != nil {
+			return fmt.Errorf("malformed query parameter %s: %s", k, err)
+		}
+		if err := bindDeepObjectPath(v, path, query[k]); err != nil {
+			return fmt.Errorf("query parameter %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+// parseDeepObjectKey splits the bracketed suffix of a
+// deep-object query key, e.g. "[a][b]", into its segments.
+func parseDeepObjectKey(s string) ([]string, error) {
+	var path []string
+	for s != "" {
+		if s[0] != '[' {
+			return nil, errors.New("expected '['")
+		}
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, errors.New("missing closing ']'")
+		}
+		seg := s[1:end]
+		if seg == "" || strings.ContainsRune(seg, '[') {
+			return nil, errors.New("invalid empty or nested brackets")
+		}
+		path = append(path, seg)
+		s = s[end+1:]
+	}
+	return path, nil
+}
+
+// bindDeepObjectPath walks the struct value v following the
+// segments of path, allocating nil pointers along the way,
+// and binds values to the designated leaf field.
+func bindDeepObjectPath(v reflect.Value, path []string, values []string) error {
+	for _, seg := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		if !isDeepObject(v.Type()) {
+			return fmt.Errorf("cannot bind key '%s' to a non-object field", seg)
+		}
+		f, ok := deepObjectField(v.Type(), seg)
+		if !ok {
+			return fmt.Errorf("unknown field '%s'", seg)
+		}
+		v = v.FieldByIndex(f.Index)
+	}
+	if isDeepObject(v.Type()) {
+		return errors.New("object field expects nested keys")
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(v.Type(), 0, len(values))
+		for _, val := range values {
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := bindStringValue(val, e); err != nil {
+				return err
+			}
+			s = reflect.Append(s, e)
+		}
+		v.Set(s)
+		return nil
+	}
+	if len(values) > 1 {
+		return errors.New("multiple values not supported")
+	}
+	return bindStringValue(values[0], v)
+}
+
+// deepObjectField returns the exported field of the struct
+// type t matching name, either by its query tag or, if the
+// field has none, by its name regardless of the case.
+func deepObjectField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag := f.Tag.Get(tagNames.Query); tag != "" {
+			if n, err := ParseTagKey(tag); err == nil && n == name {
+				return f, true
+			}
+			continue
+		}
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
 // Public signature does not expose "required" and "default" because
 // they are deprecated in favor of the "validate" and "default" tags
 func parseTagKey(tag string) (string, bool, string, error) {
@@ -374,8 +1295,8 @@ func parseTagKey(tag string) (string, bool, string, error) {
 		o = strings.TrimSpace(o)
 		if o == RequiredTag {
 			required = true
-		} else if strings.HasPrefix(o, fmt.Sprintf("%s=", DefaultTag)) {
-			defaultVal = strings.TrimPrefix(o, fmt.Sprintf("%s=", DefaultTag))
+		} else if strings.HasPrefix(o, tagNames.Default+"=") {
+			defaultVal = strings.TrimPrefix(o, tagNames.Default+"=")
 		} else {
 			return "", false, "", fmt.Errorf("malformed tag for param '%s': unknown option '%s'", name, o)
 		}
@@ -399,6 +1320,18 @@ func bindStringValue(s string, v reflect.Value) error {
 	if !v.CanSet() {
 		return fmt.Errorf("unaddressable value: %v", v)
 	}
+	// Use the binder registered for the type, if any.
+	if fn, ok := getBinder(v.Type()); ok {
+		rv, err := fn(s)
+		if err != nil {
+			return err
+		}
+		if !rv.IsValid() || !rv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("binder for type %v returned a value of incompatible type", v.Type())
+		}
+		v.Set(rv)
+		return nil
+	}
 	i := reflect.New(v.Type()).Interface()
 
 	// If the value implements the encoding.TextUnmarshaler
@@ -1,15 +1,22 @@
 package tonic_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
 	"github.com/loopfz/gadgeto/iffy"
 	"github.com/loopfz/gadgeto/tonic"
 )
@@ -26,6 +33,12 @@ func errorHook(c *gin.Context, e error) (int, interface{}) {
 func TestMain(m *testing.M) {
 
 	tonic.SetErrorHook(errorHook)
+	tonic.RegisterBinder(reflect.TypeOf(uuid.UUID{}), func(s string) (reflect.Value, error) {
+		u, err := uuid.Parse(s)
+		return reflect.ValueOf(u), err
+	})
+	tonic.RegisterBinder(reflect.TypeOf(point{}), parsePoint)
+	tonic.RegisterQueryParser("filters", parseFilters)
 
 	g := gin.Default()
 	g.GET("/simple", tonic.Handler(simpleHandler, 200))
@@ -34,7 +47,35 @@ func TestMain(m *testing.M) {
 	g.GET("/path/:param", tonic.Handler(pathHandler, 200))
 	g.GET("/query", tonic.Handler(queryHandler, 200))
 	g.GET("/query-old", tonic.Handler(queryHandlerOld, 200))
+	g.GET("/query-deep", tonic.Handler(queryDeepHandler, 200))
+	g.GET("/query-nested", tonic.Handler(queryNestedHandler, 200))
+	g.GET("/query-parser", tonic.Handler(queryParserHandler, 200))
+	g.GET("/sparse", tonic.Handler(sparseHandler, 200, tonic.SparseFields()))
+	g.GET("/sparse-disabled", tonic.Handler(sparseHandler, 200))
+	g.GET("/groups", func(c *gin.Context) {
+		if role := c.GetHeader("X-Role"); role != "" {
+			tonic.SetGroups(c, role)
+		}
+	}, tonic.Handler(groupsHandler, 200))
 	g.POST("/body", tonic.Handler(bodyHandler, 200))
+	g.POST("/body-conditional", tonic.Handler(bodyConditionalHandler, 200))
+	g.GET("/query-enum", tonic.Handler(queryEnumHandler, 200))
+	g.GET("/query-items", tonic.Handler(queryItemsHandler, 200))
+	g.GET("/pattern/:slug", tonic.Handler(patternHandler, 200))
+	g.GET("/binder/:id", tonic.Handler(binderHandler, 200))
+	g.PUT("/status-triple", tonic.Handler(statusTripleHandler, 200))
+	g.PUT("/status-wrapper", tonic.Handler(statusWrapperHandler, 200))
+	g.POST("/headers", tonic.Handler(headersHandler, 201))
+	g.POST("/accepted", tonic.Handler(acceptedHandler, 201))
+	g.POST("/body-limited", tonic.Handler(bodyHandler, 200, tonic.MaxBodyBytes(32)))
+	g.POST("/body-defaults", tonic.Handler(bodyDefaultsHandler, 200))
+	g.POST("/form/:id", tonic.Handler(formHandler, 200))
+	g.POST("/xml/:id", tonic.Handler(xmlHandler, 200))
+	g.PATCH("/body-defaults", tonic.Handler(bodyDefaultsHandler, 200, tonic.WithoutValidation()))
+	g.GET("/cookie", tonic.Handler(cookieHandler, 200))
+	g.GET("/cache-static", tonic.Handler(scalarHandler, 200, tonic.CacheControl("public, max-age=60")))
+	g.GET("/cache-dynamic", tonic.Handler(cacheHandler, 200, tonic.CacheControl("public, max-age=60")))
+	g.GET("/cache-error", tonic.Handler(errorHandler, 200, tonic.CacheControl("public, max-age=60")))
 
 	r = g
 
@@ -45,7 +86,7 @@ func TestSimple(t *testing.T) {
 
 	tester := iffy.NewTester(t, r)
 
-	tester.AddCall("simple", "GET", "/simple", "").Checkers(iffy.ExpectStatus(200), expectEmptyBody)
+	tester.AddCall("simple", "GET", "/simple", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectEmptyBody())
 	tester.AddCall("simple", "GET", "/simple/", "").Checkers(iffy.ExpectStatus(301))
 	tester.AddCall("simple", "GET", "/simple?", "").Checkers(iffy.ExpectStatus(200))
 	tester.AddCall("simple", "GET", "/simple", "{}").Checkers(iffy.ExpectStatus(200))
@@ -65,6 +106,193 @@ func TestError(t *testing.T) {
 	tester.Run()
 }
 
+func TestBindError(t *testing.T) {
+
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+
+	tonic.SetErrorHook(func(c *gin.Context, e error) (int, interface{}) {
+		var be tonic.BindError
+		if !errors.As(e, &be) {
+			return 500, e.Error()
+		}
+		typ := ""
+		if be.Type() != nil {
+			typ = be.Type().Name()
+		}
+		return 400, gin.H{
+			"error":    be.Error(),
+			"field":    be.Field(),
+			"type":     typ,
+			"location": be.Location(),
+			"param":    be.Param(),
+			"value":    be.Value(),
+			"wrapped":  errors.Unwrap(be) != nil,
+		}
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("bind-error-query", "GET", "/query?param=foo&param-int=abc", "").Checkers(
+		iffy.ExpectStatus(400),
+		expectString("field", "ParamInt"),
+		expectString("type", "queryIn"),
+		expectString("location", "query"),
+		expectString("param", "param-int"),
+		expectString("value", "abc"),
+		expectBool("wrapped", true),
+		expectStringInBody("binding error on field 'ParamInt' of type 'queryIn'"),
+	)
+	tester.AddCall("bind-error-enum", "GET", "/query-enum?levels=low&levels=medium", "").Checkers(
+		iffy.ExpectStatus(400),
+		expectString("location", "query"),
+		expectString("param", "levels"),
+		expectString("value", "medium"),
+	)
+	tester.AddCall("bind-error-body", "POST", "/body", `{"param": 42}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectString("location", "body"),
+		expectBool("wrapped", true),
+	)
+	tester.AddCall("bind-error-validation", "POST", "/body", `{}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectString("location", ""),
+	)
+
+	tester.Run()
+}
+
+type itemIn struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type itemsMeta struct {
+	Label string `json:"label" validate:"max=3"`
+}
+
+type itemsIn struct {
+	itemsMeta
+	Owner string              `query:"owner" validate:"required"`
+	Items []*itemIn           `json:"items" validate:"dive"`
+	Tags  map[string][]itemIn `json:"tags" validate:"dive,dive"`
+}
+
+func itemsHandler(c *gin.Context, in *itemsIn) error { return nil }
+
+func TestFieldErrors(t *testing.T) {
+
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+
+	tonic.SetErrorHook(func(c *gin.Context, e error) (int, interface{}) {
+		var be tonic.BindError
+		if !errors.As(e, &be) {
+			return 500, e.Error()
+		}
+		return 400, gin.H{"errors": be.FieldErrors()}
+	})
+
+	g := gin.New()
+	g.POST("/items", tonic.Handler(itemsHandler, 204))
+
+	tester := iffy.NewTester(t, g)
+
+	tester.AddCall("field-errors-slice", "POST", "/items?owner=foo", `{"items": [{"name": "a"}, {"name": "b"}, {}, {"name": "d"}]}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectBody(`{"errors":[{"path":"items[2].name","field":"Items[2].Name","tag":"required"}]}`),
+	)
+	tester.AddCall("field-errors-map", "POST", "/items", `{"tags": {"foo": [{"name": "a"}, {}]}}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectBody(`{"errors":[{"path":"owner","field":"Owner","tag":"required"},{"path":"tags[foo][1].name","field":"Tags[foo][1].Name","tag":"required"}]}`),
+	)
+	tester.AddCall("field-errors-embedded", "POST", "/items?owner=foo", `{"label": "toolong"}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectBody(`{"errors":[{"path":"label","field":"itemsMeta.Label","tag":"max","param":"3"}]}`),
+	)
+	tester.AddCall("field-errors-map-key-dots", "POST", "/items?owner=foo", `{"tags": {"a.b": [{}]}}`).Checkers(
+		iffy.ExpectStatus(400),
+		expectBody(`{"errors":[{"path":"tags[a.b][0].name","field":"Tags[a.b][0].Name","tag":"required"}]}`),
+	)
+	tester.AddCall("field-errors-valid", "POST", "/items?owner=foo", `{"items": [{"name": "a"}]}`).Checkers(iffy.ExpectStatus(204))
+
+	tester.Run()
+}
+
+func TestErrorHookLegacy(t *testing.T) {
+
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+
+	tonic.SetErrorHookLegacy(func(e error) (int, interface{}) {
+		return 418, "legacy: " + e.Error()
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("error-legacy", "GET", "/error", "").Checkers(iffy.ExpectStatus(418), expectStringInBody("legacy: error"))
+
+	tester.Run()
+}
+
+func TestContentNegotiation(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("accept-none", "GET", "/path/foo", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectHeader("Content-Type", "application/json; charset=utf-8"), expectString("param", "foo"))
+	tester.AddCall("accept-json", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "application/json"}).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+	tester.AddCall("accept-xml", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "application/xml"}).Checkers(
+		iffy.ExpectStatus(200),
+		iffy.ExpectHeader("Content-Type", "application/xml; charset=utf-8"),
+		expectStringInBody("<pathIn><Param>foo</Param></pathIn>"),
+	)
+	tester.AddCall("accept-quality", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "application/xml;q=0.5, application/json"}).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+	tester.AddCall("accept-browser", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "text/html,application/xml;q=0.9,*/*;q=0.8"}).Checkers(iffy.ExpectStatus(200), expectStringInBody("<Param>foo</Param>"))
+	tester.AddCall("accept-unsupported", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "text/html"}).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+
+	tester.Run()
+}
+
+func TestRenderHook(t *testing.T) {
+
+	defer tonic.SetRenderHook(tonic.GetRenderHook(), tonic.MediaType())
+
+	tonic.SetRenderHook(func(c *gin.Context, status int, payload interface{}) {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			c.String(500, err.Error())
+			return
+		}
+		c.Data(status, "application/vnd.envelope+json", []byte(fmt.Sprintf(`{"data": %s}`, b)))
+	}, "application/vnd.envelope+json")
+
+	if mt := tonic.MediaType(); mt != "application/vnd.envelope+json" {
+		t.Errorf("unexpected media type %s", mt)
+	}
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("render-hook", "GET", "/path/foo", "").Checkers(
+		iffy.ExpectStatus(200),
+		iffy.ExpectHeader("Content-Type", "application/vnd.envelope+json"),
+		iffy.ExpectJSONBranch("data", "param", "foo"),
+	)
+	tester.AddCall("render-hook-error", "GET", "/error", "").Checkers(iffy.ExpectStatus(500), expectStringInBody(`{"data": "error"}`))
+
+	tester.Run()
+}
+
+func TestRegisterMediaType(t *testing.T) {
+
+	tonic.RegisterMediaType("text/plain", func(c *gin.Context, status int, payload interface{}) {
+		c.String(status, "%v", payload)
+	})
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("accept-text", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "text/plain"}).Checkers(iffy.ExpectStatus(200), iffy.ExpectHeader("Content-Type", "text/plain; charset=utf-8"), expectStringInBody("&{foo}"))
+	tester.AddCall("accept-text-wildcard", "GET", "/path/foo", "").Headers(iffy.Headers{"Accept": "text/*"}).Checkers(iffy.ExpectStatus(200), expectStringInBody("<Param>foo</Param>"))
+	tester.AddCall("accept-default", "GET", "/path/foo", "").Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+
+	tester.Run()
+}
+
 func TestPathQuery(t *testing.T) {
 
 	tester := iffy.NewTester(t, r)
@@ -79,6 +307,11 @@ func TestPathQuery(t *testing.T) {
 	tester.AddCall("query-int", "GET", "/query?param=foo&param-int=42", "").Checkers(iffy.ExpectStatus(200), expectInt("param-int", 42))
 	tester.AddCall("query-multiple", "GET", "/query?param=foo&params=foo&params=bar", "").Checkers(iffy.ExpectStatus(200), expectStringArr("params", "foo", "bar"))
 	tester.AddCall("query-bool", "GET", "/query?param=foo&param-bool=true", "").Checkers(iffy.ExpectStatus(200), expectBool("param-bool", true))
+	tester.AddCall("query-float32", "GET", "/query?param=foo&param-float32=-2.5", "").Checkers(iffy.ExpectStatus(200), expectFloat("param-float32", -2.5))
+	tester.AddCall("query-float32-overflow", "GET", "/query?param=foo&param-float32=1e39", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("query-float64", "GET", "/query?param=foo&param-float64=1.25e2", "").Checkers(iffy.ExpectStatus(200), expectFloat("param-float64", 125))
+	tester.AddCall("query-float64-big", "GET", "/query?param=foo&param-float64=-1e39", "").Checkers(iffy.ExpectStatus(200), expectFloat("param-float64", -1e39))
+	tester.AddCall("query-float-invalid", "GET", "/query?param=foo&param-float64=abc", "").Checkers(iffy.ExpectStatus(400))
 	tester.AddCall("query-override-default", "GET", "/query?param=foo&param-default=bla", "").Checkers(iffy.ExpectStatus(200), expectString("param-default", "bla"))
 	tester.AddCall("query-ptr", "GET", "/query?param=foo&param-ptr=bar", "").Checkers(iffy.ExpectStatus(200), expectString("param-ptr", "bar"))
 	tester.AddCall("query-embed", "GET", "/query?param=foo&param-embed=bar", "").Checkers(iffy.ExpectStatus(200), expectString("param-embed", "bar"))
@@ -94,10 +327,326 @@ func TestPathQuery(t *testing.T) {
 	tester.AddCall("query-explode-string", "GET", "/query?param=foo&param-explode-string=x,y,z", "").Checkers(iffy.ExpectStatus(200), expectString("param-explode-string", "x,y,z"))
 	tester.AddCall("query-explode-default", "GET", "/query?param=foo", "").Checkers(iffy.ExpectStatus(200), expectStringArr("param-explode-default", "1", "2", "3"))             // default with explode
 	tester.AddCall("query-explode-disabled-default", "GET", "/query?param=foo", "").Checkers(iffy.ExpectStatus(200), expectStringArr("param-explode-disabled-default", "1,2,3")) // default without explode
+	tester.AddCall("query-explode-disabled-pipe", "GET", "/query?param=foo&param-pipe=x|y||z", "").Checkers(iffy.ExpectStatus(200), expectStringArr("param-pipe", "x", "y", "z"))
+	tester.AddCall("query-explode-disabled-pipe-comma", "GET", "/query?param=foo&param-pipe=x,y", "").Checkers(iffy.ExpectStatus(200), expectStringArr("param-pipe", "x,y"))
+	tester.AddCall("query-explode-disabled-pipe-error", "GET", "/query?param=foo&param-pipe=x&param-pipe=y", "").Checkers(iffy.ExpectStatus(400), expectStringInBody(`use \"|\"-separated list`))
+	tester.AddCall("query-explode-disabled-space", "GET", "/query?param=foo&param-space=1%202%203", "").Checkers(iffy.ExpectStatus(200), expectStringArr("param-space", "1", "2", "3"))
+
+	tester.Run()
+}
+
+func TestQueryDeepObject(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("deep-object", "GET", "/query-deep?sort[field]=name&sort[dir]=asc", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("sort", "field", "name"), iffy.ExpectJSONBranch("sort", "dir", "asc"))
+	tester.AddCall("deep-object-multi-level", "GET", "/query-deep?filter[range][min]=3&filter[tags]=a&filter[tags]=b", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("filter", "range", "min", "3"))
+	tester.AddCall("deep-object-absent", "GET", "/query-deep", "").Checkers(iffy.ExpectStatus(200), expectNull("filter"))
+	tester.AddCall("deep-object-not-object", "GET", "/query-deep?sort=name", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("deep-object-too-deep", "GET", "/query-deep?sort[field][x]=name", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("deep-object-not-leaf", "GET", "/query-deep?filter[range]=3", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("deep-object-unknown", "GET", "/query-deep?sort[unknown]=x", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("deep-object-malformed", "GET", "/query-deep?sort[field=x", "").Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestQueryCaseInsensitive(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("query-case-sensitive", "GET", "/query?Param=foo", "").Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+
+	tonic.SetQueryCaseInsensitive(true)
+	defer tonic.SetQueryCaseInsensitive(false)
+
+	tester = iffy.NewTester(t, r)
+
+	tester.AddCall("query-case-insensitive", "GET", "/query?PARAM=foo&Param-Int=42", "").Checkers(iffy.ExpectStatus(200), expectString("param", "foo"), expectInt("param-int", 42))
+	tester.AddCall("query-case-insensitive-exact", "GET", "/query?param=foo", "").Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+	tester.AddCall("query-case-insensitive-collision", "GET", "/query?param=foo&Param=bar", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("multiple values not supported"))
+	tester.AddCall("query-case-insensitive-collision-slice", "GET", "/query?param=foo&Params=b&params=a&PARAMS=c", "").Checkers(iffy.ExpectStatus(200), expectStringArr("params", "a", "c", "b"))
+
+	tester.Run()
+}
+
+func TestQueryParser(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("query-parser", "GET", "/query-parser?filter=field:status,op:eq,value:open&filter=field:owner,op:ne,value:me", "").Checkers(
+		iffy.ExpectStatus(200),
+		expectBody(`{"filters":[{"field":"status","op":"eq","value":"open"},{"field":"owner","op":"ne","value":"me"}]}`),
+	)
+	tester.AddCall("query-parser-absent", "GET", "/query-parser", "").Checkers(iffy.ExpectStatus(200), expectNull("filters"))
+	tester.AddCall("query-parser-error", "GET", "/query-parser?filter=field:status", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("invalid filter field:status"))
 
 	tester.Run()
 }
 
+func TestQueryParserUnknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a handler with an unknown query parser should panic")
+		}
+	}()
+	tonic.Handler(func(c *gin.Context, in *struct {
+		Values []string `query:"values" queryparser:"nope"`
+	}) error {
+		return nil
+	}, 200)
+}
+
+func TestQueryNested(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("query-nested", "GET", "/query-nested?limit=5&name=foo&min=1&max=3&cursor=abc", "").Checkers(
+		iffy.ExpectStatus(200),
+		iffy.ExpectJSONBranch("pagination", "limit", "5"),
+		iffy.ExpectJSONBranch("pagination", "offset", "0"),
+		iffy.ExpectJSONBranch("filters", "name", "foo"),
+		iffy.ExpectJSONBranch("filters", "range", "min", "1"),
+		iffy.ExpectJSONBranch("filters", "range", "max", "3"),
+		iffy.ExpectJSONBranch("node", "cursor", "abc"),
+		expectNull("skipped"),
+	)
+	tester.AddCall("query-nested-defaults", "GET", "/query-nested", "").Checkers(
+		iffy.ExpectStatus(200),
+		iffy.ExpectJSONBranch("pagination", "limit", "10"),
+		iffy.ExpectJSONBranch("filters", "range", "min", "0"),
+	)
+	tester.AddCall("query-nested-invalid", "GET", "/query-nested?max=foo", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("field 'Max' of type 'nestedRange'"))
+
+	tester.Run()
+}
+
+func TestSparseFields(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("sparse-all", "GET", "/sparse", "").Checkers(iffy.ExpectStatus(200), expectBody(`{"items":[{"id":1,"name":"foo","owner":{"name":"bar","email":"bar@example.com"}}],"total":1}`))
+	tester.AddCall("sparse-top", "GET", "/sparse?fields=total", "").Checkers(iffy.ExpectStatus(200), expectBody(`{"total":1}`))
+	tester.AddCall("sparse-nested", "GET", "/sparse?fields=items.id,items.owner.name,unknown", "").Checkers(iffy.ExpectStatus(200), expectBody(`{"items":[{"id":1,"owner":{"name":"bar"}}]}`))
+	tester.AddCall("sparse-whole", "GET", "/sparse?fields=items.owner.name,items.owner", "").Checkers(iffy.ExpectStatus(200), expectBody(`{"items":[{"owner":{"email":"bar@example.com","name":"bar"}}]}`))
+	tester.AddCall("sparse-disabled", "GET", "/sparse-disabled?fields=total", "").Checkers(iffy.ExpectStatus(200), expectStringInBody(`"items"`))
+
+	tester.Run()
+}
+
+func TestGroups(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("groups-none", "GET", "/groups", "").Checkers(iffy.ExpectStatus(200), expectBody(`[{"id":1,"name":"foo","profile":{"bio":"hello"}}]`))
+	tester.AddCall("groups-support", "GET", "/groups", "").Headers(iffy.Headers{"X-Role": "support"}).Checkers(iffy.ExpectStatus(200), expectBody(`[{"email":"foo@example.com","id":1,"name":"foo","profile":{"bio":"hello"}}]`))
+	tester.AddCall("groups-admin", "GET", "/groups", "").Headers(iffy.Headers{"X-Role": "admin"}).Checkers(iffy.ExpectStatus(200), expectBody(`[{"Secret":"s3cr3t","email":"foo@example.com","id":1,"name":"foo","profile":{"bio":"hello","notes":"vip"}}]`))
+
+	tester.Run()
+}
+
+func TestDryRun(t *testing.T) {
+	tonic.SetDryRunParam("dryRun")
+	defer tonic.SetDryRunParam("")
+
+	calls := 0
+	g := gin.New()
+	g.POST("/dry-run", tonic.Handler(func(c *gin.Context, in *bodyIn) (*bodyIn, error) {
+		calls++
+		return in, nil
+	}, 201))
+
+	for _, tc := range []struct {
+		query, body string
+		code, calls int
+	}{
+		{"?dryRun=true", `{"param": "foo"}`, 204, 0},
+		{"?dryRun=true", `{}`, 400, 0},
+		{"?dryRun=false", `{"param": "foo"}`, 201, 1},
+		{"", `{"param": "foo"}`, 201, 2},
+	} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("POST", "/dry-run"+tc.query, strings.NewReader(tc.body)))
+		if w.Code != tc.code || calls != tc.calls {
+			t.Errorf("%s %s: expected status %d and %d calls, got %d and %d", tc.query, tc.body, tc.code, tc.calls, w.Code, calls)
+		}
+	}
+
+	tonic.SetDryRunParam("")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("POST", "/dry-run?dryRun=true", strings.NewReader(`{"param": "foo"}`)))
+	if w.Code != 201 || calls != 3 {
+		t.Errorf("the dry-run mode should be disabled, got status %d", w.Code)
+	}
+}
+
+type tagNamesIn struct {
+	Name   string `q:"name" def:"foo"`
+	Limit  int    `q:"limit,def=10"`
+	ID     int    `p:"id"`
+	Token  string `h:"X-Token"`
+	Query  string `query:"name"`
+	Param  string `json:"param"`
+	Header string `header:"X-Token" json:"header"`
+}
+
+func TestTagNames(t *testing.T) {
+	defer tonic.SetTagNames(tonic.GetTagNames())
+
+	for _, tc := range []tonic.TagConfig{
+		{Query: "q", Path: "p", Header: "h"},
+		{Query: "q", Path: "q", Header: "h", Default: "def"},
+	} {
+		if err := tonic.SetTagNames(tc); err == nil {
+			t.Errorf("expected an error for %+v", tc)
+		}
+	}
+	if err := tonic.SetTagNames(tonic.TagConfig{Query: "q", Path: "p", Header: "h", Default: "def"}); err != nil {
+		t.Fatal(err)
+	}
+	g := gin.New()
+	g.POST("/tags/:id", tonic.Handler(func(c *gin.Context, in *tagNamesIn) (*tagNamesIn, error) {
+		return in, nil
+	}, 200))
+
+	for _, tc := range []struct {
+		query, expected string
+	}{
+		{"", `{"Name":"foo","Limit":10,"ID":42,"Token":"bar","Query":"","param":"baz","header":""}`},
+		{"?name=qux&limit=3", `{"Name":"qux","Limit":3,"ID":42,"Token":"bar","Query":"","param":"baz","header":""}`},
+	} {
+		req := httptest.NewRequest("POST", "/tags/42"+tc.query, strings.NewReader(`{"param": "baz"}`))
+		req.Header.Set("X-Token", "bar")
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+		} else if err := expectBody(tc.expected)(w.Result(), w.Body.String(), nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+type pathDefaultIn struct {
+	Path  string `path:"path" default:"/index.html"`
+	Depth int    `path:"depth,default=1"`
+}
+
+func TestPathDefault(t *testing.T) {
+	g := gin.New()
+	h := tonic.Handler(func(c *gin.Context, in *pathDefaultIn) (*pathDefaultIn, error) {
+		return in, nil
+	}, 200)
+	g.GET("/files/*path", h)
+	g.GET("/depth/:depth/*path", h)
+
+	for _, tc := range []struct {
+		url, expected string
+	}{
+		{"/files/", `{"Path":"/index.html","Depth":1}`},
+		{"/files/a/b.txt", `{"Path":"/a/b.txt","Depth":1}`},
+		{"/depth/3/", `{"Path":"/index.html","Depth":3}`},
+		{"/depth/3/c", `{"Path":"/c","Depth":3}`},
+	} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		if w.Code != 200 {
+			t.Errorf("%s: unexpected response %d %s", tc.url, w.Code, w.Body.String())
+		} else if err := expectBody(tc.expected)(w.Result(), w.Body.String(), nil); err != nil {
+			t.Errorf("%s: %s", tc.url, err)
+		}
+	}
+}
+
+func TestUnsupportedMediaType(t *testing.T) {
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+	tonic.SetErrorHook(tonic.DefaultErrorHook)
+
+	tonic.RegisterBinding("application/vnd.body", binding.JSON)
+
+	g := gin.New()
+	g.POST("/body", tonic.Handler(bodyHandler, 200))
+
+	for _, tc := range []struct {
+		contentType, body string
+		expected          int
+	}{
+		{"", `{"param": "foo"}`, 200},
+		{"application/json; charset=utf-8", `{"param": "foo"}`, 200},
+		{"application/vnd.body", `{"param": "foo"}`, 200},
+		{"application/merge-patch+json", `{"param": "foo"}`, 200},
+		{"application/vnd.body+xml", `<bodyIn><Param>foo</Param></bodyIn>`, 200},
+		{"text/yaml", "param: foo", 200},
+		{"text/plain", "foo", 415},
+		{"not a media type", "foo", 415},
+		{"text/plain", "", 400},
+	} {
+		req := httptest.NewRequest("POST", "/body", strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		if w.Code != tc.expected {
+			t.Errorf("%q: expected status %d, got %d %s", tc.contentType, tc.expected, w.Code, w.Body.String())
+		}
+		if w.Code == 415 && !strings.Contains(w.Body.String(), "application/vnd.body") {
+			t.Errorf("expected the accepted media types in the error, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestRenderXMLFallback(t *testing.T) {
+	g := gin.New()
+	g.GET("/map", tonic.Handler(func(c *gin.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"param": "foo"}, nil
+	}, 200))
+
+	req := httptest.NewRequest("GET", "/map", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("unexpected response %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	} else if err := expectBody(`{"param":"foo"}`)(w.Result(), w.Body.String(), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+
+	g := gin.New()
+	if err := g.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	g.GET("/client-ip", tonic.Handler(clientIPHandler, 200))
+
+	for _, tc := range []struct {
+		remoteAddr, forwardedFor, expected string
+	}{
+		{"192.168.1.1:4242", "", "192.168.1.1"},
+		{"10.0.0.1:4242", "203.0.113.7", "203.0.113.7"},    // trusted proxy
+		{"192.168.1.1:4242", "203.0.113.7", "192.168.1.1"}, // untrusted proxy
+	} {
+		req := httptest.NewRequest("GET", "/client-ip", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+
+		if w.Code != 200 {
+			t.Fatalf("unexpected status code %d", w.Code)
+		}
+		if err := expectString("ip", tc.expected)(w.Result(), w.Body.String(), nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func TestPathQueryBackwardsCompatible(t *testing.T) {
 
 	tester := iffy.NewTester(t, r)
@@ -130,6 +679,338 @@ func TestBody(t *testing.T) {
 	tester.Run()
 }
 
+func TestBodyMaxBodyBytes(t *testing.T) {
+
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+
+	tonic.SetErrorHook(func(c *gin.Context, e error) (int, interface{}) {
+		var mbe *http.MaxBytesError
+		if errors.As(e, &mbe) {
+			return http.StatusRequestEntityTooLarge, e.Error()
+		}
+		return errorHook(c, e)
+	})
+
+	large := fmt.Sprintf(`{"param": "foo", "param-optional": "%s"}`, strings.Repeat("a", 1024))
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("body-limited-ok", "POST", "/body-limited", `{"param": "foo"}`).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+	tester.AddCall("body-limited-too-large", "POST", "/body-limited", large).Checkers(iffy.ExpectStatus(413))
+	tester.AddCall("body-global-limit", "POST", "/body", large).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+
+	tester.Run()
+}
+
+func TestBodyDefaults(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("body-defaults", "POST", "/body-defaults", `{}`).Checkers(
+		iffy.ExpectStatus(200),
+		expectInt("memory_gb", 2048),
+		expectInt("count", 5),
+		expectStringArr("tags", "a", "b"),
+		iffy.ExpectJSONBranch("nested", "name", "foo"),
+		iffy.ExpectJSONBranch("ptr", "level", "3"),
+		expectString("ptr-scalar", "bar"),
+		expectNull("no-defaults"),
+	)
+	tester.AddCall("body-defaults-empty", "POST", "/body-defaults", "").Checkers(iffy.ExpectStatus(200), expectInt("memory_gb", 2048))
+	tester.AddCall("body-defaults-override", "POST", "/body-defaults", `{"memory_gb": 4096, "nested": {"name": "bar"}, "ptr": {}}`).Checkers(
+		iffy.ExpectStatus(200),
+		expectInt("memory_gb", 4096),
+		iffy.ExpectJSONBranch("nested", "name", "bar"),
+		iffy.ExpectJSONBranch("ptr", "level", "3"),
+	)
+	tester.AddCall("body-defaults-explicit-zero", "POST", "/body-defaults", `{"count": 0, "ptr": {"level": 0}}`).Checkers(
+		iffy.ExpectStatus(200),
+		expectInt("count", 0),
+		iffy.ExpectJSONBranch("ptr", "level", "0"),
+	)
+	tester.AddCall("body-defaults-then-validate", "POST", "/body-defaults", `{"memory_gb": 512}`).Checkers(iffy.ExpectStatus(400), expectStringInBody("'min'"))
+
+	tester.Run()
+}
+
+func TestForm(t *testing.T) {
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("name", "foo")
+	fw, err := mw.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("not really a png"))
+	mw.Close()
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("form-urlencoded", "POST", "/form/42?verbose=true", "name=foo").
+		Headers(iffy.Headers{"Content-Type": "application/x-www-form-urlencoded"}).
+		Checkers(iffy.ExpectStatus(200), expectString("id", "42"), expectString("name", "foo"), expectBool("verbose", true), expectString("avatar", ""))
+	tester.AddCall("form-urlencoded-missing", "POST", "/form/42", "other=foo").
+		Headers(iffy.Headers{"Content-Type": "application/x-www-form-urlencoded"}).
+		Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("form-multipart", "POST", "/form/42", buf.String()).
+		Headers(iffy.Headers{"Content-Type": mw.FormDataContentType()}).
+		Checkers(iffy.ExpectStatus(200), expectString("name", "foo"), expectString("avatar", "avatar.png"), expectInt("avatar-size", 16))
+
+	tester.Run()
+}
+
+func TestXMLBody(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("xml", "POST", "/xml/42", `<order><ref>foo</ref><quantity>3</quantity></order>`).
+		Headers(iffy.Headers{"Content-Type": "application/xml"}).
+		Checkers(iffy.ExpectStatus(200), expectString("id", "42"), expectString("ref", "foo"), expectInt("quantity", 3))
+	tester.AddCall("xml-text", "POST", "/xml/42", `<order><ref>foo</ref></order>`).
+		Headers(iffy.Headers{"Content-Type": "text/xml; charset=utf-8"}).
+		Checkers(iffy.ExpectStatus(200), expectString("ref", "foo"))
+	tester.AddCall("xml-validation", "POST", "/xml/42", `<order><quantity>3</quantity></order>`).
+		Headers(iffy.Headers{"Content-Type": "application/xml"}).
+		Checkers(iffy.ExpectStatus(400), expectStringInBody("'required'"))
+	tester.AddCall("xml-malformed", "POST", "/xml/42", `<order><ref>foo</order>`).
+		Headers(iffy.Headers{"Content-Type": "application/xml"}).
+		Checkers(iffy.ExpectStatus(400), expectStringInBody("error parsing request body"))
+	tester.AddCall("xml-json-default", "POST", "/xml/42", `{"ref": "foo"}`).Checkers(iffy.ExpectStatus(200), expectString("ref", "foo"))
+
+	tester.Run()
+}
+
+func TestWithoutValidation(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("validated-post", "POST", "/body-defaults", `{"memory_gb": 512}`).Checkers(iffy.ExpectStatus(400), expectStringInBody("'min'"))
+	tester.AddCall("unvalidated-patch", "PATCH", "/body-defaults", `{"memory_gb": 512}`).Checkers(iffy.ExpectStatus(200), expectInt("memory_gb", 512), expectInt("count", 5))
+	tester.AddCall("unvalidated-patch-bind-error", "PATCH", "/body-defaults", `{"memory_gb": "foo"}`).Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestBodyConditionalRequired(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("required-with-absent", "POST", "/body-conditional", `{}`).Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("required-with-ok", "POST", "/body-conditional", `{"phone": "0600000000", "country": "FR"}`).Checkers(iffy.ExpectStatus(200), expectString("country", "FR"))
+	tester.AddCall("required-with-missing", "POST", "/body-conditional", `{"phone": "0600000000"}`).Checkers(iffy.ExpectStatus(400), expectStringInBody("failed on the 'required_with' tag"))
+	tester.AddCall("required-if-ok", "POST", "/body-conditional", `{"kind": "company", "vat": "FR42"}`).Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("required-if-missing", "POST", "/body-conditional", `{"kind": "company"}`).Checkers(iffy.ExpectStatus(400), expectStringInBody("failed on the 'required_if' tag"))
+	tester.AddCall("required-if-other", "POST", "/body-conditional", `{"kind": "person"}`).Checkers(iffy.ExpectStatus(200))
+
+	tester.Run()
+}
+
+func TestQueryEnumSet(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("enum-set-ok", "GET", "/query-enum?roles=admin&roles=guest&levels=low&levels=high", "").Checkers(iffy.ExpectStatus(200), expectStringArr("roles", "admin", "guest"), expectStringArr("levels", "low", "high"))
+	tester.AddCall("enum-set-invalid-validate", "GET", "/query-enum?roles=admin&roles=root", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("'oneof'"))
+	tester.AddCall("enum-set-invalid-tag", "GET", "/query-enum?levels=low&levels=medium", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("enum-set-explode-disabled", "GET", "/query-enum?levels-csv=low,high", "").Checkers(iffy.ExpectStatus(200), expectStringArr("levels-csv", "low", "high"))
+	tester.AddCall("enum-set-explode-disabled-invalid", "GET", "/query-enum?levels-csv=low,medium", "").Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestQueryEnum(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("enum-string", "GET", "/query-enum?status=closed", "").Checkers(iffy.ExpectStatus(200), expectString("status", "closed"))
+	tester.AddCall("enum-string-invalid", "GET", "/query-enum?status=archived", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("enum=[open closed pending]"))
+	tester.AddCall("enum-int", "GET", "/query-enum?priority=2", "").Checkers(iffy.ExpectStatus(200), expectInt("priority", 2))
+	tester.AddCall("enum-int-leading-zero", "GET", "/query-enum?priority=02", "").Checkers(iffy.ExpectStatus(200), expectInt("priority", 2))
+	tester.AddCall("enum-int-invalid", "GET", "/query-enum?priority=4", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("enum-int-not-a-number", "GET", "/query-enum?priority=high", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("enum-uint-slice", "GET", "/query-enum?sizes=16&sizes=8", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("enum-uint-slice-invalid", "GET", "/query-enum?sizes=16&sizes=32", "").Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestQueryItems(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("items-ok", "GET", "/query-items?ids=1&ids=2", "").Checkers(iffy.ExpectStatus(200), expectStringArr("ids", "1", "2"))
+	tester.AddCall("items-max", "GET", "/query-items?ids=1&ids=2&ids=3", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("items-too-many", "GET", "/query-items?ids=1&ids=2&ids=3&ids=4", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("at most 3 values, got 4"))
+	tester.AddCall("items-too-few", "GET", "/query-items?ids=1", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("at least 2 values, got 1"))
+	tester.AddCall("items-absent", "GET", "/query-items", "").Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("items-explode-disabled", "GET", "/query-items?ids-csv=1,2,3", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("at most 2 values, got 3"))
+
+	tester.Run()
+}
+
+func TestPattern(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("pattern-ok", "GET", "/pattern/my-post-2?versions=v1&versions=v12", "").Checkers(iffy.ExpectStatus(200), expectString("slug", "my-post-2"))
+	tester.AddCall("pattern-path-invalid", "GET", "/pattern/My_Post", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("does not match the pattern ^[a-z0-9-]+$"))
+	tester.AddCall("pattern-query-invalid", "GET", "/pattern/my-post?versions=v1&versions=latest", "").Checkers(iffy.ExpectStatus(400), expectStringInBody("does not match the pattern"))
+
+	tester.Run()
+}
+
+func TestItemsInvalidTag(t *testing.T) {
+	expectPanic := func(tag string, register func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("registering a handler with an invalid %s tag should panic", tag)
+			}
+		}()
+		register()
+	}
+	expectPanic("minitems", func() {
+		tonic.Handler(func(c *gin.Context, in *struct {
+			IDs []string `query:"ids" minitems:"two"`
+		}) error {
+			return nil
+		}, 200)
+	})
+	expectPanic("maxitems", func() {
+		tonic.Handler(func(c *gin.Context, in *struct {
+			IDs []string `query:"ids" maxitems:"1.5"`
+		}) error {
+			return nil
+		}, 200)
+	})
+}
+
+func TestPatternInvalidTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a handler with an invalid pattern tag should panic")
+		}
+	}()
+	tonic.Handler(func(c *gin.Context, in *struct {
+		Bad string `query:"bad" pattern:"^(foo"`
+	}) error {
+		return nil
+	}, 200)
+}
+
+func TestBinder(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	id := "0f2d6a2e-6c1a-4b8e-9b2a-2f1e7f1b6c3d"
+	id2 := "7a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+
+	tester.AddCall("binder-path", "GET", "/binder/"+id, "").Checkers(iffy.ExpectStatus(200), expectString("id", id))
+	tester.AddCall("binder-path-invalid", "GET", "/binder/foo", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("binder-query-slice", "GET", "/binder/"+id+"?ids="+id+"&ids="+id2, "").Checkers(iffy.ExpectStatus(200), expectStringArr("ids", id, id2))
+	tester.AddCall("binder-query-ptr", "GET", "/binder/"+id+"?ref="+id2, "").Checkers(iffy.ExpectStatus(200), expectString("ref", id2))
+	tester.AddCall("binder-custom-struct", "GET", "/binder/"+id+"?point=3:4", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectJSONBranch("point", "y", "4"))
+	tester.AddCall("binder-custom-struct-invalid", "GET", "/binder/"+id+"?point=3", "").Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestStatusCode(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("status-triple-created", "PUT", "/status-triple", `{"param": "new"}`).Checkers(iffy.ExpectStatus(201), expectString("param", "new"))
+	tester.AddCall("status-triple-updated", "PUT", "/status-triple", `{"param": "foo"}`).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+	tester.AddCall("status-triple-default", "PUT", "/status-triple", `{"param": "default"}`).Checkers(iffy.ExpectStatus(200))
+	tester.AddCall("status-triple-error", "PUT", "/status-triple", `{}`).Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("status-wrapper-created", "PUT", "/status-wrapper", `{"param": "new"}`).Checkers(iffy.ExpectStatus(201), expectString("param", "new"))
+	tester.AddCall("status-wrapper-updated", "PUT", "/status-wrapper", `{"param": "foo"}`).Checkers(iffy.ExpectStatus(200), expectString("param", "foo"))
+
+	tester.Run()
+}
+
+func TestStatusCodeInvalidSignature(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a handler with a non-int status code should panic")
+		}
+	}()
+	tonic.Handler(func(c *gin.Context) (string, string, error) {
+		return "", "", nil
+	}, 200)
+}
+
+func TestHeaderSetter(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("headers", "POST", "/headers", `{"param": "foo"}`).Checkers(iffy.ExpectStatus(201), iffy.ExpectHeader("Location", "/body/foo"), iffy.ExpectHeader("ETag", `"foo-1"`), expectString("param", "foo"))
+
+	tester.Run()
+}
+
+func TestAccepted(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("accepted", "POST", "/accepted", "").Checkers(iffy.ExpectStatus(202), iffy.ExpectHeader("Location", "/operations/42"), expectString("id", "42"))
+	tester.AddCall("accepted-no-body", "POST", "/accepted?empty=true", "").Checkers(iffy.ExpectStatus(202), iffy.ExpectHeader("Location", "/operations/42"), iffy.ExpectEmptyBody())
+
+	tester.Run()
+}
+
+func TestCookie(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("cookie", "GET", "/cookie", "").Headers(iffy.Headers{"Cookie": "session=abc; lang=fr; count=3"}).Checkers(iffy.ExpectStatus(200), expectString("session", "abc"), expectString("lang", "fr"), expectInt("count", 3))
+	tester.AddCall("cookie-defaults", "GET", "/cookie", "").Headers(iffy.Headers{"Cookie": "session=abc"}).Checkers(iffy.ExpectStatus(200), expectString("lang", "en"), expectInt("count", 1))
+	tester.AddCall("cookie-missing-required", "GET", "/cookie", "").Checkers(iffy.ExpectStatus(400))
+	tester.AddCall("cookie-invalid", "GET", "/cookie", "").Headers(iffy.Headers{"Cookie": "session=abc; count=foo"}).Checkers(iffy.ExpectStatus(400))
+
+	tester.Run()
+}
+
+func TestCookieSliceField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a handler with a slice-typed cookie field should panic")
+		}
+	}()
+	tonic.Handler(func(c *gin.Context, in *struct {
+		Sessions []string `cookie:"session"`
+	}) error {
+		return nil
+	}, 200)
+}
+
+func TestCookieSliceNestedField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a handler with a slice-typed cookie field in a sub-struct should panic")
+		}
+	}()
+	tonic.Handler(func(c *gin.Context, in *struct {
+		Auth *struct {
+			Sessions []string `cookie:"session"`
+		}
+	}) error {
+		return nil
+	}, 200)
+}
+
+func TestCacheControl(t *testing.T) {
+
+	tester := iffy.NewTester(t, r)
+
+	tester.AddCall("cache-static", "GET", "/cache-static", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectHeader("Cache-Control", "public, max-age=60"))
+	tester.AddCall("cache-dynamic", "GET", "/cache-dynamic", "").Checkers(iffy.ExpectStatus(200), iffy.ExpectHeader("Cache-Control", "private, max-age=5"))
+	tester.AddCall("cache-error", "GET", "/cache-error", "").Checkers(iffy.ExpectStatus(500), iffy.Not(iffy.ExpectHeaderPresent("Cache-Control")))
+
+	tester.Run()
+}
+
 func errorHandler(c *gin.Context) error {
 	return errors.New("error")
 }
@@ -142,6 +1023,121 @@ func scalarHandler(c *gin.Context) (string, error) {
 	return "", nil
 }
 
+type role string
+
+type queryEnumIn struct {
+	Roles     []role   `query:"roles" json:"roles" validate:"dive,oneof=admin user guest"`
+	Levels    []string `query:"levels" json:"levels" enum:"low,high"`
+	LevelsCSV []string `query:"levels-csv" json:"levels-csv" enum:"low,high" explode:"false"`
+	Status    string   `query:"status" json:"status" enum:"open, closed, pending"`
+	Priority  int      `query:"priority" json:"priority" enum:"1,2,3"`
+	Sizes     []uint   `query:"sizes" json:"sizes" enum:"8,16"`
+}
+
+type patternIn struct {
+	Slug     string   `path:"slug" json:"slug" pattern:"^[a-z0-9-]+$"`
+	Versions []string `query:"versions" json:"versions" pattern:"^v[0-9]+$"`
+}
+
+func patternHandler(c *gin.Context, in *patternIn) (*patternIn, error) {
+	return in, nil
+}
+
+type queryItemsIn struct {
+	IDs    []string `query:"ids" json:"ids" minitems:"2" maxitems:"3"`
+	IDsCSV []string `query:"ids-csv" json:"ids-csv" explode:"false" maxitems:"2"`
+}
+
+func queryItemsHandler(c *gin.Context, in *queryItemsIn) (*queryItemsIn, error) {
+	return in, nil
+}
+
+func queryEnumHandler(c *gin.Context, in *queryEnumIn) (*queryEnumIn, error) {
+	return in, nil
+}
+
+type point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func parsePoint(s string) (reflect.Value, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return reflect.Value{}, fmt.Errorf("invalid point %s", s)
+	}
+	x, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	y, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(point{X: x, Y: y}), nil
+}
+
+type binderIn struct {
+	ID    uuid.UUID   `path:"id" json:"id"`
+	IDs   []uuid.UUID `query:"ids" json:"ids"`
+	Ref   *uuid.UUID  `query:"ref" json:"ref"`
+	Point point       `query:"point" json:"point"`
+}
+
+func binderHandler(c *gin.Context, in *binderIn) (*binderIn, error) {
+	return in, nil
+}
+
+func statusTripleHandler(c *gin.Context, in *bodyIn) (*bodyIn, int, error) {
+	switch in.Param {
+	case "new":
+		return in, 201, nil
+	case "default":
+		return in, 0, nil
+	}
+	return in, 200, nil
+}
+
+func statusWrapperHandler(c *gin.Context, in *bodyIn) (*tonic.StatusResponse, error) {
+	if in.Param == "new" {
+		return &tonic.StatusResponse{Code: 201, Body: in}, nil
+	}
+	return &tonic.StatusResponse{Code: 200, Body: in}, nil
+}
+
+type headersOut struct {
+	Param string `json:"param"`
+}
+
+func (h *headersOut) SetHeaders(header http.Header) {
+	header.Set("Location", "/body/"+h.Param)
+	header.Set("ETag", fmt.Sprintf(`"%s-1"`, h.Param))
+}
+
+func headersHandler(c *gin.Context, in *bodyIn) (*headersOut, error) {
+	return &headersOut{Param: in.Param}, nil
+}
+
+type cookieIn struct {
+	Session string `cookie:"session,required" json:"session"`
+	Lang    string `cookie:"lang,default=en" json:"lang"`
+	Count   int    `cookie:"count" json:"count" default:"1"`
+}
+
+func cookieHandler(c *gin.Context, in *cookieIn) (*cookieIn, error) {
+	return in, nil
+}
+
+type cacheOut struct {
+	Value string `json:"value"`
+}
+
+func (cacheOut) CacheControl() string { return "private, max-age=5" }
+
+func cacheHandler(c *gin.Context) (*cacheOut, error) {
+	return &cacheOut{Value: "foo"}, nil
+}
+
 type pathIn struct {
 	Param string `path:"param" json:"param"`
 }
@@ -156,6 +1152,8 @@ type queryIn struct {
 	Params                      []string  `query:"params" json:"params"`
 	ParamInt                    int       `query:"param-int" json:"param-int"`
 	ParamBool                   bool      `query:"param-bool" json:"param-bool"`
+	ParamFloat32                float32   `query:"param-float32" json:"param-float32"`
+	ParamFloat64                float64   `query:"param-float64" json:"param-float64"`
 	ParamDefault                string    `query:"param-default" json:"param-default" default:"default" validate:"required"`
 	ParamPtr                    *string   `query:"param-ptr" json:"param-ptr"`
 	ParamComplex                time.Time `query:"param-complex" json:"param-complex"`
@@ -164,6 +1162,8 @@ type queryIn struct {
 	ParamExplodeString          string    `query:"param-explode-string" json:"param-explode-string" explode:"true"`
 	ParamExplodeDefault         []string  `query:"param-explode-default" json:"param-explode-default" default:"1,2,3" explode:"true"`
 	ParamExplodeDefaultDisabled []string  `query:"param-explode-disabled-default" json:"param-explode-disabled-default" default:"1,2,3" explode:"false"`
+	ParamPipeDelimited          []string  `query:"param-pipe" json:"param-pipe" explode:"false" delimiter:"|"`
+	ParamSpaceDelimited         []string  `query:"param-space" json:"param-space" explode:"false" delimiter:" "`
 	*DoubleEmbedded
 }
 
@@ -181,6 +1181,153 @@ type DoubleEmbedded struct {
 	Embedded
 }
 
+type nestedPagination struct {
+	Limit  int `query:"limit" json:"limit" default:"10"`
+	Offset int `query:"offset" json:"offset"`
+}
+
+type nestedRange struct {
+	Min int `query:"min" json:"min"`
+	Max int `query:"max" json:"max"`
+}
+
+type nestedFilters struct {
+	Name  string       `query:"name" json:"name"`
+	Range *nestedRange `json:"range"`
+}
+
+type nestedNode struct {
+	Cursor string      `query:"cursor" json:"cursor"`
+	Next   *nestedNode `json:"next,omitempty"`
+}
+
+type queryNestedIn struct {
+	Pagination nestedPagination `json:"pagination"`
+	Filters    *nestedFilters   `json:"filters"`
+	Node       nestedNode       `json:"node"`
+	Skipped    *struct {
+		Name string `json:"name"`
+	} `json:"skipped"`
+}
+
+func queryNestedHandler(c *gin.Context, in *queryNestedIn) (*queryNestedIn, error) {
+	return in, nil
+}
+
+type queryFilter struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+func parseFilters(values []string, t reflect.Type) (reflect.Value, error) {
+	filters := make([]queryFilter, 0, len(values))
+	for _, v := range values {
+		f := queryFilter{}
+		for _, part := range strings.Split(v, ",") {
+			kv := strings.SplitN(part, ":", 2)
+			if len(kv) != 2 {
+				return reflect.Value{}, fmt.Errorf("invalid filter %s", v)
+			}
+			switch kv[0] {
+			case "field":
+				f.Field = kv[1]
+			case "op":
+				f.Op = kv[1]
+			case "value":
+				f.Value = kv[1]
+			}
+		}
+		if f.Field == "" || f.Op == "" {
+			return reflect.Value{}, fmt.Errorf("invalid filter %s", v)
+		}
+		filters = append(filters, f)
+	}
+	return reflect.ValueOf(filters), nil
+}
+
+type queryParserIn struct {
+	Filters []queryFilter `query:"filter" json:"filters" queryparser:"filters"`
+}
+
+func queryParserHandler(c *gin.Context, in *queryParserIn) (*queryParserIn, error) {
+	return in, nil
+}
+
+type groupsProfile struct {
+	Bio   string `json:"bio"`
+	Notes string `json:"notes" groups:"admin"`
+}
+
+type groupsBase struct {
+	ID     int    `json:"id"`
+	Secret string `groups:"admin"`
+}
+
+type groupsUser struct {
+	groupsBase
+	Name    string         `json:"name"`
+	Email   string         `json:"email" groups:"admin, support"`
+	Profile *groupsProfile `json:"profile"`
+}
+
+func groupsHandler(c *gin.Context) ([]groupsUser, error) {
+	return []groupsUser{{
+		groupsBase: groupsBase{ID: 1, Secret: "s3cr3t"},
+		Name:       "foo",
+		Email:      "foo@example.com",
+		Profile:    &groupsProfile{Bio: "hello", Notes: "vip"},
+	}}, nil
+}
+
+type sparseOwner struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type sparseItem struct {
+	ID    int         `json:"id"`
+	Name  string      `json:"name"`
+	Owner sparseOwner `json:"owner"`
+}
+
+type sparseOut struct {
+	Items []*sparseItem `json:"items"`
+	Total int           `json:"total"`
+}
+
+func sparseHandler(c *gin.Context) (*sparseOut, error) {
+	return &sparseOut{
+		Items: []*sparseItem{{ID: 1, Name: "foo", Owner: sparseOwner{Name: "bar", Email: "bar@example.com"}}},
+		Total: 1,
+	}, nil
+}
+
+type queryDeepIn struct {
+	Sort struct {
+		Field string `json:"field"`
+		Dir   string `json:"dir"`
+	} `query:"sort" json:"sort"`
+	Filter *struct {
+		Range struct {
+			Min int `query:"min" json:"min"`
+		} `json:"range"`
+		Tags []string `json:"tags"`
+	} `query:"filter" json:"filter"`
+}
+
+func queryDeepHandler(c *gin.Context, in *queryDeepIn) (*queryDeepIn, error) {
+	return in, nil
+}
+
+type clientIPIn struct {
+	IP string `clientip:"true" json:"ip"`
+}
+
+func clientIPHandler(c *gin.Context, in *clientIPIn) (*clientIPIn, error) {
+	return in, nil
+}
+
 func queryHandler(c *gin.Context, in *queryIn) (*queryIn, error) {
 	return in, nil
 }
@@ -189,6 +1336,52 @@ func queryHandlerOld(c *gin.Context, in *queryInOld) (*queryInOld, error) {
 	return in, nil
 }
 
+type acceptedIn struct {
+	Empty bool `query:"empty"`
+}
+
+type operation struct {
+	ID string `json:"id"`
+}
+
+func acceptedHandler(c *gin.Context, in *acceptedIn) (*tonic.Accepted, error) {
+	if in.Empty {
+		return &tonic.Accepted{Location: "/operations/42"}, nil
+	}
+	return &tonic.Accepted{Location: "/operations/42", Body: &operation{ID: "42"}}, nil
+}
+
+type formIn struct {
+	ID      string                `path:"id"`
+	Verbose bool                  `query:"verbose"`
+	Name    string                `form:"name" validate:"required"`
+	Avatar  *multipart.FileHeader `form:"avatar"`
+}
+
+func formHandler(c *gin.Context, in *formIn) (map[string]interface{}, error) {
+	ret := map[string]interface{}{
+		"id":      in.ID,
+		"verbose": in.Verbose,
+		"name":    in.Name,
+		"avatar":  "",
+	}
+	if in.Avatar != nil {
+		ret["avatar"] = in.Avatar.Filename
+		ret["avatar-size"] = in.Avatar.Size
+	}
+	return ret, nil
+}
+
+type xmlIn struct {
+	ID       string `path:"id" json:"id" xml:"-"`
+	Ref      string `json:"ref" xml:"ref" validate:"required"`
+	Quantity int    `json:"quantity" xml:"quantity"`
+}
+
+func xmlHandler(c *gin.Context, in *xmlIn) (*xmlIn, error) {
+	return in, nil
+}
+
 type bodyIn struct {
 	Param                  string `json:"param" validate:"required"`
 	ParamOptional          string `json:"param-optional"`
@@ -199,11 +1392,52 @@ func bodyHandler(c *gin.Context, in *bodyIn) (*bodyIn, error) {
 	return in, nil
 }
 
-func expectEmptyBody(r *http.Response, body string, obj interface{}) error {
-	if len(body) != 0 {
-		return fmt.Errorf("Body '%s' should be empty", body)
+type bodyDefaultsNode struct {
+	Level int               `json:"level" default:"3"`
+	Next  *bodyDefaultsNode `json:"next"`
+}
+
+type bodyDefaultsIn struct {
+	MemoryGB  int      `json:"memory_gb" validate:"min=1024" default:"2048"`
+	Count     int      `json:"count" default:"5"`
+	Tags      []string `json:"tags" default:"a,b"`
+	PtrScalar *string  `json:"ptr-scalar" default:"bar"`
+	Nested    struct {
+		Name string `json:"name" default:"foo"`
+	} `json:"nested"`
+	Ptr        *bodyDefaultsNode `json:"ptr"`
+	NoDefaults *struct {
+		Name string `json:"name"`
+	} `json:"no-defaults"`
+}
+
+func bodyDefaultsHandler(c *gin.Context, in *bodyDefaultsIn) (*bodyDefaultsIn, error) {
+	return in, nil
+}
+
+type bodyConditionalIn struct {
+	Phone   string `json:"phone"`
+	Country string `json:"country" validate:"required_with=Phone"`
+	Kind    string `json:"kind"`
+	VAT     string `json:"vat" validate:"required_if=Kind company"`
+}
+
+func bodyConditionalHandler(c *gin.Context, in *bodyConditionalIn) (*bodyConditionalIn, error) {
+	return in, nil
+}
+
+func expectBody(expected string) func(*http.Response, string, interface{}) error {
+
+	return func(r *http.Response, body string, obj interface{}) error {
+		compact := new(bytes.Buffer)
+		if err := json.Compact(compact, []byte(body)); err != nil {
+			return err
+		}
+		if compact.String() != expected {
+			return fmt.Errorf("Body '%s' does not match '%s'", compact, expected)
+		}
+		return nil
 	}
-	return nil
 }
 
 func expectString(paramName, value string) func(*http.Response, string, interface{}) error {
@@ -252,6 +1486,31 @@ func expectBool(paramName string, value bool) func(*http.Response, string, inter
 	}
 }
 
+func expectFloat(paramName string, value float64) func(*http.Response, string, interface{}) error {
+
+	return func(r *http.Response, body string, obj interface{}) error {
+
+		i := map[string]interface{}{paramName: 0}
+
+		err := json.Unmarshal([]byte(body), &i)
+		if err != nil {
+			return err
+		}
+		v, ok := i[paramName]
+		if !ok {
+			return fmt.Errorf("%s missing", paramName)
+		}
+		vf, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s not a number", paramName)
+		}
+		if vf != value {
+			return fmt.Errorf("%s: expected %v got %v", paramName, value, vf)
+		}
+		return nil
+	}
+}
+
 func expectStringArr(paramName string, value ...string) func(*http.Response, string, interface{}) error {
 
 	return func(r *http.Response, body string, obj interface{}) error {
@@ -282,6 +1541,27 @@ func expectStringArr(paramName string, value ...string) func(*http.Response, str
 	}
 }
 
+func expectNull(paramName string) func(*http.Response, string, interface{}) error {
+
+	return func(r *http.Response, body string, obj interface{}) error {
+
+		var i map[string]interface{}
+
+		err := json.Unmarshal([]byte(body), &i)
+		if err != nil {
+			return err
+		}
+		v, ok := i[paramName]
+		if !ok {
+			return fmt.Errorf("%s missing", paramName)
+		}
+		if v != nil {
+			return fmt.Errorf("%s: expected null got %v", paramName, v)
+		}
+		return nil
+	}
+}
+
 func expectStringInBody(value string) func(*http.Response, string, interface{}) error {
 
 	return func(r *http.Response, body string, obj interface{}) error {
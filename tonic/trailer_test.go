@@ -0,0 +1,82 @@
+package tonic_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+type trailerIn struct {
+	Data     string `json:"data"`
+	Checksum string `trailer:"X-Checksum" validate:"required"`
+	Algo     string `trailer:"X-Checksum-Algo" default:"sha256"`
+}
+
+func trailerHandler(c *gin.Context, in *trailerIn) (*trailerIn, error) {
+	return in, nil
+}
+
+func TestTrailer(t *testing.T) {
+	defer tonic.SetErrorHook(tonic.GetErrorHook())
+	tonic.SetErrorHook(tonic.DefaultErrorHook)
+
+	g := gin.New()
+	g.POST("/upload", tonic.Handler(trailerHandler, 200))
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	post := func(trailer http.Header) (*http.Response, string) {
+		t.Helper()
+		pr, pw := io.Pipe()
+		req, err := http.NewRequest("POST", srv.URL+"/upload", pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		// Declare the trailers, and set their
+		// values once the body is written.
+		req.Trailer = http.Header{}
+		for k := range trailer {
+			req.Trailer.Set(k, "")
+		}
+		go func() {
+			pw.Write([]byte(`{"data": "foo"}`))
+			for k := range trailer {
+				req.Trailer.Set(k, trailer.Get(k))
+			}
+			pw.Close()
+		}()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(b)
+	}
+
+	resp, body := post(http.Header{"X-Checksum": {"abc"}})
+	if resp.StatusCode != 200 {
+		t.Errorf("unexpected response %d %s", resp.StatusCode, body)
+	} else if err := expectBody(`{"data":"foo","Checksum":"abc","Algo":"sha256"}`)(resp, body, nil); err != nil {
+		t.Error(err)
+	}
+	resp, body = post(http.Header{"X-Checksum": {"abc"}, "X-Checksum-Algo": {"md5"}})
+	if resp.StatusCode != 200 {
+		t.Errorf("unexpected response %d %s", resp.StatusCode, body)
+	} else if err := expectBody(`{"data":"foo","Checksum":"abc","Algo":"md5"}`)(resp, body, nil); err != nil {
+		t.Error(err)
+	}
+	resp, body = post(nil)
+	if resp.StatusCode != 400 || !strings.Contains(body, "Checksum") {
+		t.Errorf("expected a validation error, got %d %s", resp.StatusCode, body)
+	}
+}
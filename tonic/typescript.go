@@ -0,0 +1,266 @@
+package tonic
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// GenerateTypeScript writes the TypeScript interface definitions
+// of the input and output types of the tonic-enabled routes to w.
+// The definitions describe the JSON representation of the types:
+// fields are named after their json tag, pointer and omitempty
+// fields are optional, and enum tags are rendered as unions of
+// literals. Only the body fields of input types are described,
+// unless they are also used as output types.
+func GenerateTypeScript(w io.Writer) error {
+	g := &tsGenerator{
+		names: make(map[reflect.Type]string),
+		taken: make(map[string]reflect.Type),
+		defs:  make(map[string]string),
+	}
+	routesMu.Lock()
+	var inputs, outputs []reflect.Type
+	for _, r := range routes {
+		if r.inputType != nil {
+			inputs = append(inputs, r.inputType)
+		}
+		if r.outputType != nil {
+			outputs = append(outputs, r.outputType)
+		}
+	}
+	routesMu.Unlock()
+
+	// Routes are stored in a map: sort the types for the
+	// output, and the names given on collisions, to be stable.
+	sortTypes(inputs)
+	sortTypes(outputs)
+	// Output types first: an input type also used as an output
+	// type is described with all its fields.
+	for _, t := range outputs {
+		g.typeOf(t, false)
+	}
+	for _, t := range inputs {
+		g.typeOf(t, true)
+	}
+
+	names := make([]string, 0, len(g.defs))
+	for name := range g.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if _, err := io.WriteString(w, "// Code generated by tonic. DO NOT EDIT.\n"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "\nexport interface %s %s\n", name, g.defs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortTypes(types []reflect.Type) {
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].PkgPath()+"."+types[i].String() < types[j].PkgPath()+"."+types[j].String()
+	})
+}
+
+// tsGenerator holds the interfaces generated for the
+// named struct types met while walking the route types.
+type tsGenerator struct {
+	names map[reflect.Type]string
+	taken map[string]reflect.Type
+	defs  map[string]string
+}
+
+// typeOf returns the TypeScript type of t. Named struct types
+// are defined as interfaces, and referred to by their name.
+// If input is true, only the body fields of the struct are
+// described.
+func (g *tsGenerator) typeOf(t reflect.Type, input bool) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return "string"
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return "any"
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings.
+			return "string"
+		}
+		return arrayOf(g.typeOf(t.Elem(), false))
+	case reflect.Map:
+		return fmt.Sprintf("{ [key: string]: %s }", g.typeOf(t.Elem(), false))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.fields(t, input, "")
+		}
+		if name, ok := g.names[t]; ok {
+			return name
+		}
+		name := g.name(t)
+		// Register the name before walking the fields,
+		// for recursive types to refer to it.
+		g.names[t] = name
+		g.defs[name] = g.fields(t, input, "")
+		return name
+	default:
+		return "any"
+	}
+}
+
+// name returns a unique TypeScript name for the named type t.
+func (g *tsGenerator) name(t reflect.Type) string {
+	name := tsIdentifier(t.Name())
+	if other, ok := g.taken[name]; ok && other != t {
+		name = tsIdentifier(t.String())
+	}
+	g.taken[name] = t
+	return name
+}
+
+// fields returns the TypeScript object type of the fields
+// of the struct type t, indented with indent.
+func (g *tsGenerator) fields(t reflect.Type, input bool, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	g.writeFields(&b, t, input, indent+"  ")
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+func (g *tsGenerator) writeFields(b *strings.Builder, t reflect.Type, input bool, indent string) {
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if input && !isBodyField(ft) {
+			continue
+		}
+		tag := ft.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		fieldType := ft.Type
+		// Embedded structs without a name in the
+		// json tag have their fields promoted.
+		if ft.Anonymous && name == "" {
+			et := fieldType
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				g.writeFields(b, et, input, indent)
+				continue
+			}
+		}
+		if ft.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = ft.Name
+		}
+		optional := fieldType.Kind() == reflect.Ptr || contains(strings.Split(opts, ","), "omitempty")
+
+		elemType := fieldType
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		var typ string
+		if enum := ft.Tag.Get(EnumTag); enum != "" {
+			typ = g.enumOf(fieldType, strings.Split(enum, ","))
+		} else if elemType.Kind() == reflect.Struct && elemType.Name() == "" {
+			// Inline anonymous structs at the
+			// indentation of the field.
+			typ = g.fields(elemType, false, indent)
+		} else {
+			typ = g.typeOf(fieldType, false)
+		}
+		if optional {
+			name += "?"
+		}
+		fmt.Fprintf(b, "%s%s: %s;\n", indent, tsPropertyName(name), typ)
+	}
+}
+
+// enumOf returns the union of the literals of values, or an
+// array of such union if t is a slice.
+func (g *tsGenerator) enumOf(t reflect.Type, values []string) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return arrayOf(g.enumOf(t.Elem(), values))
+	}
+	literals := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if g.typeOf(t, false) == "number" {
+			literals = append(literals, v)
+		} else {
+			literals = append(literals, fmt.Sprintf("%q", v))
+		}
+	}
+	return strings.Join(literals, " | ")
+}
+
+// arrayOf returns the TypeScript array type of elements of type t.
+func arrayOf(t string) string {
+	if strings.Contains(t, "|") {
+		return "(" + t + ")[]"
+	}
+	return t + "[]"
+}
+
+// tsIdentifier replaces the characters of s which can't
+// appear in a TypeScript identifier, e.g. in the names of
+// instantiated generic types.
+func tsIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '$' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// tsPropertyName quotes name if it is not a valid
+// TypeScript identifier, e.g. "param-optional".
+func tsPropertyName(name string) string {
+	base := strings.TrimSuffix(name, "?")
+	if base != "" && tsIdentifier(base) == base && (base[0] < '0' || base[0] > '9') {
+		return name
+	}
+	return fmt.Sprintf("%q", base) + name[len(base):]
+}
@@ -0,0 +1,90 @@
+package tonic_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+type tsAddress struct {
+	City string `json:"city"`
+}
+
+type tsUser struct {
+	ID       string                 `json:"id"`
+	Nickname *string                `json:"nickname"`
+	Age      int                    `json:"age,omitempty"`
+	Role     string                 `json:"role" enum:"admin,guest"`
+	Levels   []int                  `json:"levels" enum:"1,2"`
+	Friends  []*tsUser              `json:"friends"`
+	Meta     map[string]interface{} `json:"meta"`
+	Created  time.Time              `json:"created"`
+	Address  tsAddress              `json:"address"`
+	Location struct {
+		Lat float64 `json:"lat"`
+	} `json:"location"`
+	Raw     []byte
+	Ignored string `json:"-"`
+	secret  string
+}
+
+type tsUserIn struct {
+	ID string `path:"id" json:"-"`
+	tsUser
+}
+
+func tsHandler(c *gin.Context, in *tsUserIn) (*tsUser, error) {
+	return &in.tsUser, nil
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	g := gin.New()
+	g.PUT("/users/:id", tonic.Handler(tsHandler, 200))
+
+	buf := new(bytes.Buffer)
+	if err := tonic.GenerateTypeScript(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		`export interface tsUser {
+  id: string;
+  nickname?: string;
+  age?: number;
+  role: "admin" | "guest";
+  levels: (1 | 2)[];
+  friends: tsUser[];
+  meta: { [key: string]: any };
+  created: string;
+  address: tsAddress;
+  location: {
+    lat: number;
+  };
+  Raw: string;
+}`,
+		`export interface tsAddress {
+  city: string;
+}`,
+		`export interface tsUserIn {
+  id: string;
+  nickname?: string;`,
+		`export interface bodyIn {
+  param: string;
+  "param-optional": string;
+  "param-optional-validated": string;
+}`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing definition:\n%s\n\nin:\n%s", e, out)
+		}
+	}
+	if strings.Contains(out, "Ignored") || strings.Contains(out, "secret") {
+		t.Errorf("ignored fields should not be generated:\n%s", out)
+	}
+}
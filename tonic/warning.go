@@ -0,0 +1,75 @@
+package tonic
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tonicWarnings = "_tonic_warnings"
+
+// WarningHook is called by the wrapping gin-handler with the
+// warnings added by a tonic-handler that succeeded, before the
+// payload is rendered. It returns the payload to render.
+type WarningHook func(c *gin.Context, warnings []string, payload interface{}) interface{}
+
+var warningHook WarningHook = DefaultWarningHook
+
+// AddWarning adds a non-fatal warning to the response of the
+// current request, e.g. the use of a deprecated parameter, or
+// a partial result. The warnings are surfaced by the warning
+// hook when the handler succeeds, and discarded otherwise.
+func AddWarning(c *gin.Context, msg string) {
+	var warnings []string
+	if w, ok := c.Get(tonicWarnings); ok {
+		warnings = w.([]string)
+	}
+	c.Set(tonicWarnings, append(warnings, msg))
+}
+
+// Warnings returns the warnings added to the response
+// of the current request.
+func Warnings(c *gin.Context) []string {
+	if w, ok := c.Get(tonicWarnings); ok {
+		return w.([]string)
+	}
+	return nil
+}
+
+// DefaultWarningHook is the default warning hook. It sets a
+// Warning header (RFC 7234, warn-code 299) for each warning,
+// and leaves the payload untouched.
+func DefaultWarningHook(c *gin.Context, warnings []string, payload interface{}) interface{} {
+	for _, w := range warnings {
+		c.Writer.Header().Add("Warning", "299 - "+strconv.Quote(w))
+	}
+	return payload
+}
+
+// WarningEnvelope is the payload rendered by EnvelopeWarningHook.
+type WarningEnvelope struct {
+	Data     interface{} `json:"data"`
+	Warnings []string    `json:"warnings"`
+}
+
+// EnvelopeWarningHook is a warning hook that wraps the payload
+// of the responses with warnings in a WarningEnvelope. Responses
+// without payload get Warning headers instead.
+func EnvelopeWarningHook(c *gin.Context, warnings []string, payload interface{}) interface{} {
+	if isNil(payload) {
+		return DefaultWarningHook(c, warnings, payload)
+	}
+	return &WarningEnvelope{Data: payload, Warnings: warnings}
+}
+
+// SetWarningHook sets the given hook as the default warning hook.
+func SetWarningHook(wh WarningHook) {
+	if wh != nil {
+		warningHook = wh
+	}
+}
+
+// GetWarningHook returns the current warning hook.
+func GetWarningHook() WarningHook {
+	return warningHook
+}
@@ -0,0 +1,78 @@
+package tonic_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gadgeto/tonic"
+)
+
+func warningHandler(c *gin.Context) (*pathIn, error) {
+	tonic.AddWarning(c, `parameter "sort" is deprecated`)
+	tonic.AddWarning(c, "partial result")
+	if c.Query("fail") != "" {
+		return nil, errors.New("failed")
+	}
+	return &pathIn{Param: "foo"}, nil
+}
+
+func warningEmptyHandler(c *gin.Context) error {
+	tonic.AddWarning(c, "partial result")
+	return nil
+}
+
+func TestWarnings(t *testing.T) {
+	g := gin.New()
+	g.GET("/warning", tonic.Handler(warningHandler, 200))
+	g.GET("/warning-empty", tonic.Handler(warningEmptyHandler, 204))
+	g.GET("/no-warning", tonic.Handler(scalarHandler, 200))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/warning", nil))
+	warnings := w.Header().Values("Warning")
+	if len(warnings) != 2 || warnings[0] != `299 - "parameter \"sort\" is deprecated"` || warnings[1] != `299 - "partial result"` {
+		t.Errorf("unexpected Warning headers %q", warnings)
+	}
+	if err := expectBody(`{"param":"foo"}`)(w.Result(), w.Body.String(), nil); err != nil {
+		t.Error(err)
+	}
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/warning?fail=1", nil))
+	if w.Code != 500 || len(w.Header().Values("Warning")) != 0 {
+		t.Errorf("warnings should be discarded on errors, got %d %q", w.Code, w.Header().Values("Warning"))
+	}
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/no-warning", nil))
+	if len(w.Header().Values("Warning")) != 0 {
+		t.Errorf("unexpected Warning headers %q", w.Header().Values("Warning"))
+	}
+}
+
+func TestEnvelopeWarningHook(t *testing.T) {
+	defer tonic.SetWarningHook(tonic.GetWarningHook())
+	tonic.SetWarningHook(tonic.EnvelopeWarningHook)
+
+	g := gin.New()
+	g.GET("/warning", tonic.Handler(warningHandler, 200))
+	g.GET("/warning-empty", tonic.Handler(warningEmptyHandler, 204))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/warning", nil))
+	if err := expectBody(`{"data":{"param":"foo"},"warnings":["parameter \"sort\" is deprecated","partial result"]}`)(w.Result(), w.Body.String(), nil); err != nil {
+		t.Error(err)
+	}
+	if len(w.Header().Values("Warning")) != 0 {
+		t.Errorf("unexpected Warning headers %q", w.Header().Values("Warning"))
+	}
+
+	// Responses without payload get headers.
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/warning-empty", nil))
+	if w.Code != 204 || w.Header().Get("Warning") != `299 - "partial result"` {
+		t.Errorf("unexpected response %d %q", w.Code, w.Header().Values("Warning"))
+	}
+}
@@ -0,0 +1,24 @@
+package zesty
+
+import "context"
+
+type providerKey struct{}
+
+// ContextWithProvider returns a copy of ctx carrying the provider dbp,
+// for the functions deep in a call chain to retrieve the ambient
+// provider, and thus its current transaction, with ProviderFromContext.
+//
+// The provider should be set once, early, e.g. by a middleware at the
+// start of a request, and not be replaced mid-way: a DBProvider is not
+// safe for concurrent use, so the context must not be shared between
+// goroutines issuing queries. Functions keep taking their dependencies
+// explicitly otherwise; the context is not meant as a service locator.
+func ContextWithProvider(ctx context.Context, dbp DBProvider) context.Context {
+	return context.WithValue(ctx, providerKey{}, dbp)
+}
+
+// ProviderFromContext returns the provider carried by ctx, if any.
+func ProviderFromContext(ctx context.Context) (DBProvider, bool) {
+	dbp, ok := ctx.Value(providerKey{}).(DBProvider)
+	return dbp, ok
+}
@@ -0,0 +1,33 @@
+package zesty
+
+import "sync/atomic"
+
+// QueryCounter counts the SQL statements issued through a gorp
+// DbMap, transaction control statements included.
+// It implements gorp.GorpLogger, and is installed on a DbMap
+// with its tracing facility:
+//
+//	counter := &zesty.QueryCounter{}
+//	dbmap.TraceOn("", counter)
+//
+// It is typically used in tests to detect query count regressions.
+type QueryCounter struct {
+	n int64
+}
+
+// Printf implements gorp.GorpLogger. It is called by
+// gorp for each statement executed.
+func (qc *QueryCounter) Printf(format string, v ...interface{}) {
+	atomic.AddInt64(&qc.n, 1)
+}
+
+// Count returns the number of statements executed
+// since the counter was created or last reset.
+func (qc *QueryCounter) Count() int {
+	return int(atomic.LoadInt64(&qc.n))
+}
+
+// Reset sets the counter back to zero.
+func (qc *QueryCounter) Reset() {
+	atomic.StoreInt64(&qc.n, 0)
+}
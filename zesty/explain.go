@@ -0,0 +1,118 @@
+package zesty
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-gorp/gorp"
+)
+
+// Explain returns the execution plan of query, as reported
+// by the EXPLAIN statement of the dialect of the database.
+// It returns an error for dialects that do not support it.
+func Explain(dbp DBProvider, query string, args ...interface{}) (string, error) {
+	return explain(dbp, false, query, args...)
+}
+
+// ExplainAnalyze executes query and returns its actual
+// execution plan, as reported by the EXPLAIN ANALYZE
+// statement of the dialect of the database.
+// Beware that the query is actually executed, so statements
+// with side effects should be run within a transaction that
+// is rolled back.
+func ExplainAnalyze(dbp DBProvider, query string, args ...interface{}) (string, error) {
+	return explain(dbp, true, query, args...)
+}
+
+func explain(dbp DBProvider, analyze bool, query string, args ...interface{}) (string, error) {
+	dialect, err := providerDialect(dbp)
+	if err != nil {
+		return "", err
+	}
+	var prefix string
+	switch dialect.(type) {
+	case gorp.PostgresDialect, *gorp.PostgresDialect, gorp.MySQLDialect, *gorp.MySQLDialect:
+		prefix = "EXPLAIN "
+		if analyze {
+			prefix = "EXPLAIN ANALYZE "
+		}
+	case gorp.SqliteDialect, *gorp.SqliteDialect:
+		if analyze {
+			return "", errors.New("EXPLAIN ANALYZE is not supported by sqlite")
+		}
+		prefix = "EXPLAIN QUERY PLAN "
+	default:
+		return "", fmt.Errorf("EXPLAIN is not supported by dialect %T", dialect)
+	}
+	rows, err := dbp.DB().Query(prefix+query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	return formatRows(rows)
+}
+
+// formatRows formats the rows of a result set into a
+// readable string: a single column result set is returned
+// line by line, otherwise the columns are aligned under a
+// header line.
+func formatRows(rows *sql.Rows) (string, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	b := new(bytes.Buffer)
+	w := tabwriter.NewWriter(b, 0, 4, 2, ' ', 0)
+	if len(cols) > 1 {
+		fmt.Fprintln(w, strings.Join(cols, "\t"))
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	line := make([]string, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		for i, v := range values {
+			if v.Valid {
+				line[i] = v.String
+			} else {
+				line[i] = "NULL"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(line, "\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// providerDialect returns the gorp dialect of the database
+// of a provider created by zesty.
+func providerDialect(dbp DBProvider) (gorp.Dialect, error) {
+	zp, ok := dbp.(*zestyprovider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider type %T", dbp)
+	}
+	db := zp.db
+	if rd, ok := db.(*replicatedDB); ok {
+		db = rd.DB
+	}
+	zd, ok := db.(*zestydb)
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type %T", zp.db)
+	}
+	return zd.Dialect, nil
+}
@@ -0,0 +1,43 @@
+package zesty
+
+import (
+	"errors"
+
+	"github.com/go-gorp/gorp"
+)
+
+// ErrOptimisticLock is matched, with errors.Is, by the errors returned
+// by Update and Delete when the version of a row changed since it was
+// loaded, or when the row was deleted. The gorp.OptimisticLockError
+// describing the row can be retrieved with errors.As.
+var ErrOptimisticLock = errors.New("optimistic lock error")
+
+type optimisticLockError struct {
+	gorp.OptimisticLockError
+}
+
+func (e optimisticLockError) Is(target error) bool { return target == ErrOptimisticLock }
+
+func (e optimisticLockError) Unwrap() error { return e.OptimisticLockError }
+
+// wrapLockError wraps the optimistic lock errors of gorp.
+func wrapLockError(err error) error {
+	if ole, ok := err.(gorp.OptimisticLockError); ok {
+		return optimisticLockError{ole}
+	}
+	return err
+}
+
+// Update updates the rows of list with exec, as gorp.SqlExecutor.Update
+// does, checking the version column of their table if it has one.
+func Update(exec gorp.SqlExecutor, list ...interface{}) (int64, error) {
+	n, err := exec.Update(list...)
+	return n, wrapLockError(err)
+}
+
+// Delete deletes the rows of list with exec, as gorp.SqlExecutor.Delete
+// does, checking the version column of their table if it has one.
+func Delete(exec gorp.SqlExecutor, list ...interface{}) (int64, error) {
+	n, err := exec.Delete(list...)
+	return n, wrapLockError(err)
+}
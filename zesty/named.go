@@ -0,0 +1,95 @@
+package zesty
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-gorp/gorp"
+)
+
+// NamedExec executes query with dbp, as gorp.SqlExecutor.Exec does,
+// after translating its :name placeholders to the positional form
+// of the dialect of the database, ordering the values of arg to
+// match. A name can be used several times in the query.
+// Placeholders within quotes, and Postgres casts (::), are left as-is.
+func NamedExec(dbp DBProvider, query string, arg map[string]interface{}) (sql.Result, error) {
+	q, args, err := namedQuery(dbp, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.DB().Exec(q, args...)
+}
+
+// NamedSelect selects rows into i with dbp, as gorp.SqlExecutor.Select
+// does, with the :name placeholders of query translated as done by
+// NamedExec.
+func NamedSelect(dbp DBProvider, i interface{}, query string, arg map[string]interface{}) ([]interface{}, error) {
+	q, args, err := namedQuery(dbp, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return dbp.DB().Select(i, q, args...)
+}
+
+func namedQuery(dbp DBProvider, query string, arg map[string]interface{}) (string, []interface{}, error) {
+	dialect, err := providerDialect(dbp)
+	if err != nil {
+		return "", nil, err
+	}
+	return bindNamed(dialect, query, arg)
+}
+
+// bindNamed replaces the :name placeholders of query with the
+// bind variables of dialect, and returns the values of arg in
+// the order of the placeholders.
+func bindNamed(dialect gorp.Dialect, query string, arg map[string]interface{}) (string, []interface{}, error) {
+	var (
+		b     strings.Builder
+		args  []interface{}
+		quote byte
+	)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == ':' && i+1 < len(query) && query[i+1] == ':':
+			// Postgres cast.
+			b.WriteString("::")
+			i++
+			continue
+		case ch == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := arg[name]
+			if !ok {
+				return "", nil, fmt.Errorf("missing value for named parameter %q", name)
+			}
+			b.WriteString(dialect.BindVar(len(args)))
+			args = append(args, v)
+			i = j - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	if quote != 0 {
+		return "", nil, fmt.Errorf("unterminated quote %q in query", quote)
+	}
+	return b.String(), args, nil
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,91 @@
+package zesty
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gorp/gorp"
+)
+
+// replicatedDB is a DB whose read-only queries can be
+// routed to read replicas. The writes, the transactions
+// and the other operations go to the primary DB.
+type replicatedDB struct {
+	DB
+	replicas []DB
+	next     uint32
+}
+
+// RegisterDBWithReplicas registers the primary DB under name, along
+// with read replicas of it. The providers of the DB route the queries
+// issued through ReadDB to the replicas, in turn, outside of
+// transactions; DB still uses the primary.
+func RegisterDBWithReplicas(name string, primary DB, replicas ...DB) error {
+	if len(replicas) == 0 {
+		return errors.New("No replica given")
+	}
+	return RegisterDB(&replicatedDB{DB: primary, replicas: replicas}, name)
+}
+
+// StickyProvider is implemented by the providers whose reads can
+// stick to the primary after a write, such as those returned by
+// NewDBProvider and NewTempDBProvider. It is only useful for the
+// providers of DBs registered with replicas.
+type StickyProvider interface {
+	StickToPrimaryAfterWrite(time.Duration)
+}
+
+// StickToPrimaryAfterWrite makes ReadDB use the primary for the
+// duration d after a write of the provider, for the reads following
+// a write not to miss it on a lagging replica (read-your-writes).
+// The calls of DB outside of a transaction, which may be used to
+// write, and the commits of root transactions count as writes.
+// Writes are tracked per provider instance, e.g. per request, and
+// not across providers. A duration of 0, the default, disables it.
+func (zp *zestyprovider) StickToPrimaryAfterWrite(d time.Duration) {
+	zp.stickiness = d
+}
+
+// wrote records a write of the provider, for
+// StickToPrimaryAfterWrite.
+func (zp *zestyprovider) wrote() {
+	if zp.stickiness > 0 {
+		zp.lastWrite = time.Now()
+	}
+}
+
+// replica returns the next replica of the database.
+func (rd *replicatedDB) replica() DB {
+	n := atomic.AddUint32(&rd.next, 1)
+	return rd.replicas[(n-1)%uint32(len(rd.replicas))]
+}
+
+// Close closes the primary DB and its replicas.
+func (rd *replicatedDB) Close() error {
+	err := rd.DB.Close()
+	for _, r := range rd.replicas {
+		if rerr := r.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// ReadDB returns the executor for read-only queries: a replica
+// of the database outside of a transaction, if the database was
+// registered with replicas, and the current DB or Tx otherwise.
+// Queries within a transaction keep reading from the primary, to
+// see the changes of the transaction.
+func (zp *zestyprovider) ReadDB() gorp.SqlExecutor {
+	if zp.tx != nil {
+		return zp.current
+	}
+	if zp.stickiness > 0 && !zp.lastWrite.IsZero() && time.Since(zp.lastWrite) < zp.stickiness {
+		return zp.current
+	}
+	if rd, ok := zp.db.(*replicatedDB); ok {
+		return rd.replica()
+	}
+	return zp.current
+}
@@ -0,0 +1,167 @@
+package zesty
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ScanResultSets scans the consecutive result sets of rows, e.g. as
+// returned by Query for a stored procedure, into dests: one pointer to
+// a slice per result set, in order. The rows of a set are appended to
+// the slice; slices of structs are filled by column name, matched with
+// the db tag of the fields or their name, case-insensitively, the fields
+// of embedded structs included, and other slices, time.Time and scanners
+// included, from single-column result sets. It does not close the rows.
+//
+// To control the iteration instead, call rows.NextResultSet() after
+// reading the rows of each set.
+func ScanResultSets(rows *sql.Rows, dests ...interface{}) error {
+	for i, dest := range dests {
+		if i > 0 && !rows.NextResultSet() {
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("missing result set %d: got %d result sets for %d destinations", i, i, len(dests))
+		}
+		if err := scanResultSet(rows, dest); err != nil {
+			return fmt.Errorf("result set %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func scanResultSet(rows *sql.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a pointer to a slice, got %T", dest)
+	}
+	slice := v.Elem()
+	et := slice.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	isStruct := et.Kind() == reflect.Struct && !isScalarStruct(et)
+	var fields [][]int
+	if isStruct {
+		fields, err = columnFields(et, cols)
+		if err != nil {
+			return err
+		}
+	} else if len(cols) != 1 {
+		return fmt.Errorf("expected a single column for %v, got %d", et, len(cols))
+	}
+	for rows.Next() {
+		elem := reflect.New(et)
+		var targets []interface{}
+		if isStruct {
+			targets = make([]interface{}, len(fields))
+			for i, index := range fields {
+				targets[i] = fieldByIndex(elem.Elem(), index).Addr().Interface()
+			}
+		} else {
+			targets = []interface{}{elem.Interface()}
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// isScalarStruct returns whether the struct type t is scanned
+// from a single column as a whole: scanners, time.Time, which
+// the drivers scan natively, and structs without exported fields.
+func isScalarStruct(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex returns the nested field of v at index,
+// allocating the nil pointers to embedded structs.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// columnFields returns the indices of the fields of
+// the struct type t matching the columns cols.
+func columnFields(t reflect.Type, cols []string) ([][]int, error) {
+	byName := make(map[string][]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fi := append(append([]int{}, index...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && ft.Kind() == reflect.Struct && !isScalarStruct(ft) {
+				// Nil pointers to unexported embedded
+				// structs can't be allocated.
+				if f.Type.Kind() != reflect.Ptr || f.PkgPath == "" {
+					walk(ft, fi)
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.SplitN(f.Tag.Get("db"), ",", 2)[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			name = strings.ToLower(name)
+			if _, ok := byName[name]; !ok {
+				byName[name] = fi
+			}
+		}
+	}
+	walk(t, nil)
+
+	fields := make([][]int, len(cols))
+	for i, col := range cols {
+		index, ok := byName[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("no field of %v for column %s", t, col)
+		}
+		fields[i] = index
+	}
+	return fields, nil
+}
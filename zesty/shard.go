@@ -0,0 +1,55 @@
+package zesty
+
+import "errors"
+
+// ShardedProvider gives access to databases sharded by key, e.g.
+// by a hash of the user id, with a provider per shard.
+//
+// Each shard has its own transactions: cross-shard transactions
+// are not supported, and a transaction opened on the provider of
+// a shard does not apply to the other shards. Like any DBProvider,
+// the provider of each shard is not safe for concurrent use.
+type ShardedProvider struct {
+	shards []DBProvider
+	shard  func(key interface{}) int
+}
+
+// NewShardedProvider returns a ShardedProvider for the databases
+// registered under names, in order, with the sharding function
+// shard returning the index of the shard of a key in names.
+func NewShardedProvider(names []string, shard func(key interface{}) int) (*ShardedProvider, error) {
+	if len(names) == 0 {
+		return nil, errors.New("No shard given")
+	}
+	if shard == nil {
+		return nil, errors.New("No sharding function given")
+	}
+	sp := &ShardedProvider{shard: shard}
+	for _, name := range names {
+		dbp, err := NewDBProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		sp.shards = append(sp.shards, dbp)
+	}
+	return sp, nil
+}
+
+// For returns the provider of the shard of key. The index
+// returned by the sharding function is taken modulo the
+// number of shards. The same provider is returned for the
+// keys of a shard, along with its current transaction.
+func (sp *ShardedProvider) For(key interface{}) DBProvider {
+	i := sp.shard(key) % len(sp.shards)
+	if i < 0 {
+		i += len(sp.shards)
+	}
+	return sp.shards[i]
+}
+
+// Shards returns the providers of all the shards, in order,
+// e.g. to run a query on each of them. The returned slice is
+// a copy: changing it does not change the routing of For.
+func (sp *ShardedProvider) Shards() []DBProvider {
+	return append([]DBProvider(nil), sp.shards...)
+}
@@ -13,6 +13,8 @@ import (
 const (
 	maxOpenConns    = 5
 	maxIdleConns    = 3
+	connMaxLifetime = time.Hour
+	connMaxIdleTime = 5 * time.Minute
 )
 
 // DatabaseConfig represents the configuration used to
@@ -23,8 +25,21 @@ type DatabaseConfig struct {
 	System           DBMS
 	MaxOpenConns     int
 	MaxIdleConns     int
-	ConnMaxLifetime  time.Duration
 	AutoCreateTables bool
+
+	// ConnMaxLifetime and ConnMaxIdleTime bound the time a
+	// pooled connection is reused, and kept idle, e.g. for
+	// the connections not to be dropped by a proxy first.
+	// Defaults apply when zero; negative values disable them.
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Migrations is an ordered list of SQL statements
+	// executed after the tables creation. Applied migrations
+	// are tracked in the schema_migrations table, so that each
+	// one runs only once: new migrations must be appended to
+	// the list, and existing ones must never be reordered.
+	Migrations []string
 }
 
 // RegisterDatabase creates a gorp map with tables and tc and
@@ -45,19 +60,28 @@ func RegisterDatabase(dbcfg *DatabaseConfig, tc gorp.TypeConverter) (zesty.DB, e
 		dbcfg.MaxIdleConns = maxIdleConns
 	}
 	dbConn.SetMaxIdleConns(dbcfg.MaxIdleConns)
+	if dbcfg.ConnMaxLifetime == 0 {
+		dbcfg.ConnMaxLifetime = connMaxLifetime
+	}
 	dbConn.SetConnMaxLifetime(dbcfg.ConnMaxLifetime)
+	if dbcfg.ConnMaxIdleTime == 0 {
+		dbcfg.ConnMaxIdleTime = connMaxIdleTime
+	}
+	dbConn.SetConnMaxIdleTime(dbcfg.ConnMaxIdleTime)
 
+	return RegisterDatabaseWithConn(dbcfg, dbConn, tc)
+}
+
+// RegisterDatabaseWithConn creates a gorp map with tables and tc on
+// the given connection, and registers it with zesty, as RegisterDatabase
+// does. The DSN and the connection pool settings of the configuration
+// are ignored, for the connection to be opened and configured by the
+// caller, e.g. wrapped for tracing, or mocked in tests.
+func RegisterDatabaseWithConn(dbcfg *DatabaseConfig, dbConn *sql.DB, tc gorp.TypeConverter) (zesty.DB, error) {
 	// Select the proper dialect used by gorp.
-	var dialect gorp.Dialect
-	switch dbcfg.System {
-	case DatabaseMySQL:
-		dialect = gorp.MySQLDialect{}
-	case DatabasePostgreSQL:
-		dialect = gorp.PostgresDialect{}
-	case DatabaseSqlite3:
-		dialect = gorp.SqliteDialect{}
-	default:
-		return nil, errors.New("unknown database system")
+	dialect, err := dbcfg.System.dialect()
+	if err != nil {
+		return nil, err
 	}
 	dbmap := &gorp.DbMap{
 		Db:            dbConn,
@@ -67,7 +91,14 @@ func RegisterDatabase(dbcfg *DatabaseConfig, tc gorp.TypeConverter) (zesty.DB, e
 	modelsMu.Lock()
 	tableModels := models[dbcfg.Name]
 	for _, t := range tableModels {
-		dbmap.AddTableWithName(t.Model, t.Name).SetKeys(t.AutoIncrement, t.Keys...)
+		if err := t.validate(); err != nil {
+			modelsMu.Unlock()
+			return nil, err
+		}
+		tm := dbmap.AddTableWithName(t.Model, t.Name).SetKeys(t.AutoIncrement, t.Keys...)
+		if t.VersionColumn != "" {
+			tm.SetVersionCol(t.VersionColumn)
+		}
 	}
 	modelsMu.Unlock()
 
@@ -77,10 +108,19 @@ func RegisterDatabase(dbcfg *DatabaseConfig, tc gorp.TypeConverter) (zesty.DB, e
 			return nil, err
 		}
 	}
+	if len(dbcfg.Migrations) > 0 {
+		if err := runMigrations(dbmap, dbcfg.Migrations); err != nil {
+			return nil, err
+		}
+	}
 	db := zesty.NewDB(dbmap)
 	if err := zesty.RegisterDB(db, dbcfg.Name); err != nil {
 		return nil, err
 	}
+	modelsMu.Lock()
+	dbmaps[dbcfg.Name] = dbmap
+	modelsMu.Unlock()
+
 	return db, nil
 }
 
@@ -92,17 +132,38 @@ const (
 	DatabasePostgreSQL DBMS = iota ^ 42
 	DatabaseMySQL
 	DatabaseSqlite3
+	DatabaseCockroach
+	DatabaseSQLServer
 )
 
 // DriverName returns the name of the driver for ds.
+// CockroachDB is wire-compatible with PostgreSQL,
+// and uses the postgres driver.
 func (d DBMS) DriverName() string {
 	switch d {
-	case DatabasePostgreSQL:
+	case DatabasePostgreSQL, DatabaseCockroach:
 		return "postgres"
 	case DatabaseMySQL:
 		return "mysql"
 	case DatabaseSqlite3:
 		return "sqlite3"
+	case DatabaseSQLServer:
+		return "sqlserver"
 	}
 	return ""
 }
+
+// dialect returns the gorp dialect for d.
+func (d DBMS) dialect() (gorp.Dialect, error) {
+	switch d {
+	case DatabaseMySQL:
+		return gorp.MySQLDialect{}, nil
+	case DatabasePostgreSQL, DatabaseCockroach:
+		return gorp.PostgresDialect{}, nil
+	case DatabaseSqlite3:
+		return gorp.SqliteDialect{}, nil
+	case DatabaseSQLServer:
+		return gorp.SqlServerDialect{}, nil
+	}
+	return nil, errors.New("unknown database system")
+}
@@ -0,0 +1,357 @@
+package rekordo
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/gadgeto/zesty"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrations(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "migrations.db")
+	migrations := []string{
+		`CREATE TABLE "user" (id BIGINT NOT NULL PRIMARY KEY, name TEXT)`,
+		`CREATE INDEX user_name_idx ON "user" (name)`,
+		`INSERT INTO "user" VALUES (1, 'admin')`,
+	}
+	cfg := &DatabaseConfig{
+		Name:       "migrations-1",
+		DSN:        dsn,
+		System:     DatabaseSqlite3,
+		Migrations: migrations,
+	}
+	db, err := RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	db.Close()
+
+	// Registering the same database again must not
+	// run the previous migrations, only the new one.
+	cfg = &DatabaseConfig{
+		Name:       "migrations-2",
+		DSN:        dsn,
+		System:     DatabaseSqlite3,
+		Migrations: append(migrations, `INSERT INTO "user" VALUES (2, 'guest')`),
+	}
+	db, err = RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+
+	n, err := db.SelectInt(`SELECT COUNT(*) FROM "user"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 users, got %d", n)
+	}
+	n, err = db.SelectInt(`SELECT COUNT(*) FROM "schema_migrations"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 applied migrations, got %d", n)
+	}
+}
+
+type membership struct {
+	UserID  int64  `db:"user_id"`
+	GroupID int64  `db:"group_id"`
+	Role    string `db:"role"`
+}
+
+func TestCompositeKeys(t *testing.T) {
+	cfg := &DatabaseConfig{
+		Name:             "composite-keys",
+		DSN:              filepath.Join(t.TempDir(), "composite.db"),
+		System:           DatabaseSqlite3,
+		AutoCreateTables: true,
+	}
+	RegisterTableModel(cfg.Name, "membership", membership{}).WithNaturalKeys("user_id", "group_id")
+
+	db, err := RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+
+	if err := db.Insert(&membership{UserID: 1, GroupID: 2, Role: "admin"}, &membership{UserID: 1, GroupID: 3, Role: "guest"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert(&membership{UserID: 1, GroupID: 2, Role: "guest"}); err == nil {
+		t.Fatal("inserting a duplicate composite key should fail")
+	}
+	m, err := db.Get(membership{}, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.(*membership).Role != "guest" {
+		t.Fatalf("unexpected membership %+v", m)
+	}
+}
+
+func TestCompositeKeysAutoIncrement(t *testing.T) {
+	cfg := &DatabaseConfig{
+		Name:   "composite-keys-autoincrement",
+		DSN:    filepath.Join(t.TempDir(), "composite.db"),
+		System: DatabaseSqlite3,
+	}
+	RegisterTableModel(cfg.Name, "membership", membership{}).WithKeys([]string{"user_id", "group_id"})
+
+	if _, err := RegisterDatabase(cfg, nil); err == nil {
+		t.Fatal("registering composite keys with auto-increment should fail")
+	}
+}
+
+type document struct {
+	ID      int64  `db:"id"`
+	Title   string `db:"title"`
+	Version int64  `db:"version"`
+}
+
+func TestVersionColumn(t *testing.T) {
+	cfg := &DatabaseConfig{
+		Name:             "version-column",
+		DSN:              filepath.Join(t.TempDir(), "version.db"),
+		System:           DatabaseSqlite3,
+		AutoCreateTables: true,
+	}
+	RegisterTableModel(cfg.Name, "document", document{}).WithVersionColumn("version")
+
+	db, err := RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+
+	doc := &document{Title: "draft"}
+	if err := db.Insert(doc); err != nil {
+		t.Fatal(err)
+	}
+	stale := *doc
+
+	doc.Title = "final"
+	if _, err := zesty.Update(db, doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 2 {
+		t.Fatalf("expected version 2 after update, got %d", doc.Version)
+	}
+
+	stale.Title = "overwrite"
+	_, err = zesty.Update(db, &stale)
+	if !errors.Is(err, zesty.ErrOptimisticLock) {
+		t.Fatalf("expected an optimistic lock error for the stale update, got %v", err)
+	}
+	var ole gorp.OptimisticLockError
+	if !errors.As(err, &ole) || !ole.RowExists || ole.LocalVersion != 1 {
+		t.Fatalf("unexpected lock error %+v", ole)
+	}
+	title, err := db.SelectStr(`SELECT title FROM "document" WHERE id = ?`, doc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "final" {
+		t.Fatalf("stale update should not have been applied, got title %q", title)
+	}
+}
+
+type article struct {
+	ID    int64  `db:"id"`
+	Title string `db:"title"`
+	Views int64  `db:"views"`
+	Cache string `db:"-"`
+}
+
+func TestVerifySchema(t *testing.T) {
+	cfg := &DatabaseConfig{
+		Name:             "verify-schema",
+		DSN:              filepath.Join(t.TempDir(), "verify.db"),
+		System:           DatabaseSqlite3,
+		AutoCreateTables: true,
+	}
+	RegisterTableModel(cfg.Name, "article", article{})
+
+	db, err := RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+
+	if err := VerifySchema(cfg.Name, true); err != nil {
+		t.Fatalf("tables created from the models should match: %s", err)
+	}
+
+	cfg = &DatabaseConfig{
+		Name:   "verify-schema-mismatch",
+		DSN:    filepath.Join(t.TempDir(), "mismatch.db"),
+		System: DatabaseSqlite3,
+		Migrations: []string{
+			`CREATE TABLE "article" (id BIGINT PRIMARY KEY, title BIGINT, legacy TEXT)`,
+		},
+	}
+	RegisterTableModel(cfg.Name, "article", article{})
+	RegisterTableModel(cfg.Name, "membership", membership{}).WithNaturalKeys("user_id", "group_id")
+
+	db, err = RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+
+	err = VerifySchema(cfg.Name, false)
+	if err == nil {
+		t.Fatal("expected a schema mismatch")
+	}
+	for _, m := range []string{
+		"table article: missing column views",
+		"table article: extra column legacy",
+		"table membership: missing table",
+	} {
+		if !strings.Contains(err.Error(), m) {
+			t.Errorf("expected %q in %s", m, err)
+		}
+	}
+	if strings.Contains(err.Error(), "column title has type") {
+		t.Errorf("types should not be compared without strictTypes: %s", err)
+	}
+	err = VerifySchema(cfg.Name, true)
+	if err == nil || !strings.Contains(err.Error(), "column title has type BIGINT, expected varchar(255)") {
+		t.Errorf("expected a type mismatch for column title, got %v", err)
+	}
+	if strings.Contains(err.Error(), "column id has type") {
+		t.Errorf("BIGINT should match integer: %s", err)
+	}
+
+	if err := VerifySchema("unknown", false); err == nil {
+		t.Error("verifying an unregistered database should fail")
+	}
+}
+
+func TestConnMaxTimes(t *testing.T) {
+	cfg := &DatabaseConfig{
+		Name:   "conn-defaults",
+		DSN:    ":memory:",
+		System: DatabaseSqlite3,
+	}
+	db, err := RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	db.Close()
+	if cfg.ConnMaxLifetime != connMaxLifetime || cfg.ConnMaxIdleTime != connMaxIdleTime {
+		t.Fatalf("expected the default durations, got %s and %s", cfg.ConnMaxLifetime, cfg.ConnMaxIdleTime)
+	}
+
+	cfg = &DatabaseConfig{
+		Name:            "conn-idle",
+		DSN:             ":memory:",
+		System:          DatabaseSqlite3,
+		ConnMaxIdleTime: time.Millisecond,
+	}
+	db, err = RegisterDatabase(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(cfg.Name)
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	// The idle connection is closed by the cleaner
+	// of database/sql, which runs every second.
+	deadline := time.Now().Add(3 * time.Second)
+	for db.Stats().MaxIdleTimeClosed == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the idle connection was not closed: %+v", db.Stats())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestDBMS(t *testing.T) {
+	for _, tc := range []struct {
+		dbms    DBMS
+		driver  string
+		dialect gorp.Dialect
+	}{
+		{DatabasePostgreSQL, "postgres", gorp.PostgresDialect{}},
+		{DatabaseMySQL, "mysql", gorp.MySQLDialect{}},
+		{DatabaseSqlite3, "sqlite3", gorp.SqliteDialect{}},
+		{DatabaseCockroach, "postgres", gorp.PostgresDialect{}},
+		{DatabaseSQLServer, "sqlserver", gorp.SqlServerDialect{}},
+	} {
+		if driver := tc.dbms.DriverName(); driver != tc.driver {
+			t.Errorf("expected driver %s for %d, got %s", tc.driver, tc.dbms, driver)
+		}
+		dialect, err := tc.dbms.dialect()
+		if err != nil {
+			t.Errorf("unexpected error for %d: %s", tc.dbms, err)
+		} else if dialect != tc.dialect {
+			t.Errorf("expected dialect %T for %d, got %T", tc.dialect, tc.dbms, dialect)
+		}
+	}
+	if DBMS(0).DriverName() != "" {
+		t.Error("expected no driver for an unknown system")
+	}
+	if _, err := DBMS(0).dialect(); err == nil {
+		t.Error("expected an error for an unknown system")
+	}
+}
+
+func TestRegisterDatabaseWithConn(t *testing.T) {
+	type item struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+	const name = "with-conn"
+	RegisterTableModel(name, "item", item{})
+
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	cfg := &DatabaseConfig{
+		Name:             name,
+		System:           DatabaseSqlite3,
+		AutoCreateTables: true,
+	}
+	db, err := RegisterDatabaseWithConn(cfg, conn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zesty.UnregisterDB(name)
+	defer db.Close()
+
+	if err := db.Insert(&item{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	// The table is mapped on the given connection.
+	rows, err := conn.Query(`SELECT name FROM "item"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("expected the row inserted through the map")
+	}
+	if cfg.MaxOpenConns != 0 {
+		t.Errorf("the pool settings should be left to the caller, got %d", cfg.MaxOpenConns)
+	}
+}
@@ -0,0 +1,99 @@
+package rekordo
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+)
+
+// migrationsTable is the name of the table tracking
+// the migrations already applied to a database.
+const migrationsTable = "schema_migrations"
+
+// MigrationsFromFS reads the files of fsys matching pattern,
+// sorted by name, and returns their content as an ordered list
+// of migrations suitable for DatabaseConfig.Migrations.
+// It is typically used with an embed.FS.
+func MigrationsFromFS(fsys fs.FS, pattern string) ([]string, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := make([]string, 0, len(names))
+	for _, n := range names {
+		b, err := fs.ReadFile(fsys, n)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, string(b))
+	}
+	return migrations, nil
+}
+
+// runMigrations executes the migrations that have not been
+// applied yet to the database, in order. Each migration is
+// identified by its position in the list, starting at 1, and
+// is recorded in the migrations table within the same
+// transaction, so that it runs only once.
+func runMigrations(dbmap *gorp.DbMap, migrations []string) error {
+	// SQL Server has no CREATE TABLE IF NOT EXISTS,
+	// the dialect provides the equivalent statement.
+	_, err := dbmap.Exec(fmt.Sprintf(
+		"%s %s (version BIGINT NOT NULL PRIMARY KEY)",
+		dbmap.Dialect.IfTableNotExists("CREATE TABLE", "", migrationsTable),
+		dbmap.Dialect.QuoteField(migrationsTable),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %s", err)
+	}
+	rows, err := dbmap.Query(fmt.Sprintf(
+		"SELECT version FROM %s", dbmap.Dialect.QuoteField(migrationsTable),
+	))
+	if err != nil {
+		return err
+	}
+	applied := make(map[int64]struct{})
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = struct{}{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, m := range migrations {
+		version := int64(i + 1)
+		if _, ok := applied[version]; ok {
+			continue
+		}
+		tx, err := dbmap.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %s", version, err)
+		}
+		_, err = tx.Exec(fmt.Sprintf(
+			"INSERT INTO %s (version) VALUES (%s)",
+			dbmap.Dialect.QuoteField(migrationsTable),
+			dbmap.Dialect.BindVar(0),
+		), version)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %s", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package rekordo
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-gorp/gorp"
+)
 
 // modelsMu protect models map.
 var modelsMu sync.Mutex
@@ -9,9 +14,14 @@ var modelsMu sync.Mutex
 // for all databases.
 var models map[string]map[string]*TableModel
 
+// dbmaps holds the gorp maps of the databases
+// registered with RegisterDatabase, by name.
+var dbmaps map[string]*gorp.DbMap
+
 func init() {
 	// Initialize tables map.
 	models = make(map[string]map[string]*TableModel)
+	dbmaps = make(map[string]*gorp.DbMap)
 }
 
 // TableModel is a middleman between a database
@@ -21,6 +31,7 @@ type TableModel struct {
 	Model         interface{}
 	Keys          []string
 	AutoIncrement bool
+	VersionColumn string
 }
 
 // RegisterTableModel registers a zero-value model to
@@ -47,7 +58,27 @@ func RegisterTableModel(dbName, tableName string, model interface{}) *TableModel
 	return m
 }
 
+// WithNaturalKeys uses keys as table keys for the model,
+// and disables auto-increment: the values of the keys are
+// provided by the model, e.g. a UUID primary key, or a
+// composite key made of several columns.
+func (tb *TableModel) WithNaturalKeys(keys ...string) *TableModel {
+	tb.Keys = keys
+	tb.AutoIncrement = false
+	return tb
+}
+
+// validate ensures that the keys configuration of the
+// table model is supported by gorp.
+func (tb *TableModel) validate() error {
+	if tb.AutoIncrement && len(tb.Keys) > 1 {
+		return fmt.Errorf("table %s: auto-increment is not supported with composite keys %v", tb.Name, tb.Keys)
+	}
+	return nil
+}
+
 // WithKeys uses keys as table keys for the model.
+// Composite keys require auto-increment to be disabled.
 func (tb *TableModel) WithKeys(keys []string) *TableModel {
 	tb.Keys = keys
 	return tb
@@ -58,3 +89,12 @@ func (tb *TableModel) WithAutoIncrement(enable bool) *TableModel {
 	tb.AutoIncrement = enable
 	return tb
 }
+
+// WithVersionColumn uses the column col, mapped to an int64 field,
+// as the version column of the table, for optimistic locking: the
+// version is incremented by each update, which fails if the version
+// of the row changed since it was loaded (see zesty.ErrOptimisticLock).
+func (tb *TableModel) WithVersionColumn(col string) *TableModel {
+	tb.VersionColumn = col
+	return tb
+}
@@ -0,0 +1,180 @@
+package rekordo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-gorp/gorp"
+)
+
+// VerifySchema checks that the live schema of the database dbName,
+// registered with RegisterDatabase, matches its registered table
+// models: each table must exist, with the columns mapped by gorp and
+// no other. With strictTypes, the type of each column must also belong
+// to the same family (integer, float, string, bytes, time) as the
+// type gorp would create it with.
+// It does not alter the database, and is meant to be called at startup
+// by services whose schema is managed separately, to fail fast. The
+// returned error lists all the mismatches found.
+func VerifySchema(dbName string, strictTypes bool) error {
+	modelsMu.Lock()
+	dbmap, ok := dbmaps[dbName]
+	tableModels := make([]*TableModel, 0, len(models[dbName]))
+	for _, t := range models[dbName] {
+		tableModels = append(tableModels, t)
+	}
+	modelsMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no database '%s' registered with rekordo", dbName)
+	}
+	sort.Slice(tableModels, func(i, j int) bool { return tableModels[i].Name < tableModels[j].Name })
+
+	var mismatches []string
+	for _, t := range tableModels {
+		m, err := verifyTable(dbmap, t, strictTypes)
+		if err != nil {
+			return err
+		}
+		mismatches = append(mismatches, m...)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("schema of database %s does not match its models:\n\t%s", dbName, strings.Join(mismatches, "\n\t"))
+	}
+	return nil
+}
+
+// verifyTable returns the mismatches between the table
+// model t and the table of the database.
+func verifyTable(dbmap *gorp.DbMap, t *TableModel, strictTypes bool) ([]string, error) {
+	tm, err := dbmap.TableFor(reflect.TypeOf(t.Model), false)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dbmap.Db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", dbmap.Dialect.QuotedTableForQuery(tm.SchemaName, tm.TableName)))
+	if err != nil {
+		return []string{fmt.Sprintf("table %s: missing table (%s)", t.Name, err)}, nil
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	actual := make(map[string]string, len(colTypes))
+	for _, ct := range colTypes {
+		actual[ct.Name()] = ct.DatabaseTypeName()
+	}
+
+	fieldTypes := modelColumnTypes(reflect.TypeOf(t.Model))
+	var mismatches []string
+	expected := make(map[string]bool, len(tm.Columns))
+	for _, col := range tm.Columns {
+		if col.Transient {
+			continue
+		}
+		expected[col.ColumnName] = true
+		dbType, ok := actual[col.ColumnName]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("table %s: missing column %s", t.Name, col.ColumnName))
+			continue
+		}
+		ft, ok := fieldTypes[col.ColumnName]
+		if !strictTypes || !ok || dbType == "" {
+			continue
+		}
+		want := dbmap.Dialect.ToSqlType(ft, col.MaxSize, false)
+		if !sameTypeFamily(want, dbType) {
+			mismatches = append(mismatches, fmt.Sprintf("table %s: column %s has type %s, expected %s", t.Name, col.ColumnName, dbType, want))
+		}
+	}
+	extra := make([]string, 0)
+	for name := range actual {
+		if !expected[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		mismatches = append(mismatches, fmt.Sprintf("table %s: extra column %s", t.Name, name))
+	}
+	return mismatches, rows.Err()
+}
+
+// modelColumnTypes returns the Go types of the columns of
+// the model type t, named after their db tag as gorp does.
+func modelColumnTypes(t reflect.Type) map[string]reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	ret := make(map[string]reflect.Type)
+	if t.Kind() != reflect.Struct {
+		return ret
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name, ft := range modelColumnTypes(f.Type) {
+				ret[name] = ft
+			}
+			continue
+		}
+		name := strings.Split(f.Tag.Get("db"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ret[name] = f.Type
+	}
+	return ret
+}
+
+// typeFamilies maps keywords of SQL type names to their
+// family, in order of precedence.
+var typeFamilies = []struct {
+	keyword, family string
+}{
+	{"interval", "interval"},
+	{"point", "point"},
+	{"int", "integer"},
+	{"serial", "integer"},
+	{"bool", "boolean"},
+	{"real", "float"},
+	{"floa", "float"},
+	{"doub", "float"},
+	{"numeric", "float"},
+	{"decimal", "float"},
+	{"char", "string"},
+	{"text", "string"},
+	{"clob", "string"},
+	{"json", "string"},
+	{"uuid", "string"},
+	{"blob", "bytes"},
+	{"bytea", "bytes"},
+	{"binary", "bytes"},
+	{"date", "time"},
+	{"time", "time"},
+}
+
+// typeFamily returns the family of the SQL type name,
+// or the lowercased name if it is not known.
+func typeFamily(sqlType string) string {
+	sqlType = strings.ToLower(sqlType)
+	for _, tf := range typeFamilies {
+		if strings.Contains(sqlType, tf.keyword) {
+			return tf.family
+		}
+	}
+	return sqlType
+}
+
+// sameTypeFamily returns whether the column type got, as reported
+// by the database, is of the same family as the type want.
+// Booleans are stored as integers by some systems (tinyint(1)).
+func sameTypeFamily(want, got string) bool {
+	wf, gf := typeFamily(want), typeFamily(got)
+	return wf == gf || wf == "boolean" && gf == "integer"
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-gorp/gorp"
 )
@@ -41,11 +42,17 @@ type Tx interface {
 
 type DBProvider interface {
 	DB() gorp.SqlExecutor
+	ReadDB() gorp.SqlExecutor
+	Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 	Tx() error
 	TxSavepoint() (SavePoint, error)
 	Commit() error
 	Rollback() error
 	RollbackTo(SavePoint) error
+	TxDepth() int
+	InTx() bool
+	OnCommit(func())
+	OnRollback(func())
 	Close() error
 	Ping() error
 	PingContext(context.Context) error
@@ -113,22 +120,47 @@ func NewTempDBProvider(db DB) DBProvider {
  */
 
 type zestyprovider struct {
-	current   gorp.SqlExecutor
-	db        DB
-	tx        Tx
-	savepoint SavePoint
+	current    gorp.SqlExecutor
+	db         DB
+	tx         Tx
+	savepoint  SavePoint
+	onCommit   []func()
+	onRollback []func()
+	// hookMarks holds, for each savepoint, the number
+	// of hooks registered when it was created.
+	hookMarks []hookMark
+	// stickiness is the time ReadDB uses the primary
+	// after lastWrite, if positive.
+	stickiness time.Duration
+	lastWrite  time.Time
+}
+
+type hookMark struct {
+	onCommit, onRollback int
 }
 
 func (zp *zestyprovider) DB() gorp.SqlExecutor {
+	if zp.tx == nil {
+		zp.wrote()
+	}
 	return zp.current
 }
 
+// Query executes a query on the current DB or Tx, and returns
+// the raw rows so that the caller can stream through them,
+// scanning one row at a time.
+// The caller is responsible for closing the rows.
+func (zp *zestyprovider) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return zp.current.WithContext(ctx).Query(query, args...)
+}
+
 func (zp *zestyprovider) Commit() error {
 	if zp.tx == nil {
 		return errors.New("No active Tx")
 	}
 
 	if zp.savepoint > 0 {
+		zp.hookMarks = zp.hookMarks[:zp.savepoint-1]
 		zp.savepoint--
 		return nil
 	}
@@ -138,7 +170,12 @@ func (zp *zestyprovider) Commit() error {
 		return err
 	}
 
+	hooks := zp.onCommit
 	zp.resetTx()
+	zp.wrote()
+	for _, f := range hooks {
+		f()
+	}
 
 	return nil
 }
@@ -172,6 +209,7 @@ func (zp *zestyprovider) TxSavepoint() (SavePoint, error) {
 			return 0, err
 		}
 
+		zp.hookMarks = append(zp.hookMarks, hookMark{onCommit: len(zp.onCommit), onRollback: len(zp.onRollback)})
 		zp.savepoint++
 	}
 
@@ -194,7 +232,11 @@ func (zp *zestyprovider) RollbackTo(sp SavePoint) error {
 			return err
 		}
 
+		hooks := zp.onRollback
 		zp.resetTx()
+		for _, f := range hooks {
+			f()
+		}
 	} else {
 		// nested transaction
 		s := fmt.Sprintf(savepointFmt, sp)
@@ -203,16 +245,67 @@ func (zp *zestyprovider) RollbackTo(sp SavePoint) error {
 			return err
 		}
 
+		// Discard the hooks registered since the
+		// savepoint, with the work rolled back.
+		mark := zp.hookMarks[sp-1]
+		zp.onCommit = zp.onCommit[:mark.onCommit]
+		zp.onRollback = zp.onRollback[:mark.onRollback]
+		zp.hookMarks = zp.hookMarks[:sp-1]
 		zp.savepoint = sp - 1
 	}
 
 	return nil
 }
 
+// TxDepth returns the nesting level of the current transaction:
+// 0 outside of a transaction, 1 in the root transaction, and one
+// more for each nested transaction.
+func (zp *zestyprovider) TxDepth() int {
+	if zp.tx == nil {
+		return 0
+	}
+	return int(zp.savepoint) + 1
+}
+
+// InTx returns whether a transaction is active.
+func (zp *zestyprovider) InTx() bool {
+	return zp.tx != nil
+}
+
+// OnCommit registers f to be called once the root transaction
+// is committed, after the commits of the nested transactions.
+// The functions are called in order of registration, and are
+// discarded if the transaction is rolled back, or rolled back to
+// a savepoint created before their registration.
+// Outside of a transaction, f is called immediately.
+func (zp *zestyprovider) OnCommit(f func()) {
+	if zp.tx == nil {
+		f()
+		return
+	}
+	zp.onCommit = append(zp.onCommit, f)
+}
+
+// OnRollback registers f to be called once the root transaction
+// is rolled back. Rollbacks to savepoints don't call it, but
+// discard the functions registered since the savepoint.
+// The functions are called in order of registration, and are
+// discarded if the transaction is committed.
+// Outside of a transaction, f is never called.
+func (zp *zestyprovider) OnRollback(f func()) {
+	if zp.tx == nil {
+		return
+	}
+	zp.onRollback = append(zp.onRollback, f)
+}
+
 func (zp *zestyprovider) resetTx() {
 	zp.current = zp.db
 	zp.tx = nil
 	zp.savepoint = 0
+	zp.onCommit = nil
+	zp.onRollback = nil
+	zp.hookMarks = nil
 }
 
 func (zp *zestyprovider) Close() error {
@@ -1,8 +1,11 @@
 package zesty
 
 import (
+	"context"
 	"database/sql"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-gorp/gorp"
 	_ "github.com/mattn/go-sqlite3"
@@ -145,3 +148,531 @@ func TestTransaction(t *testing.T) {
 		t.Fatal("rollback should fail when there is no transaction")
 	}
 }
+
+func TestExplain(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT PRIMARY KEY, name TEXT);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Explain(dbp, `SELECT * FROM "t" WHERE name = ?`, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan, "SCAN") || !strings.HasPrefix(plan, "id") {
+		t.Fatalf("unexpected plan:\n%s", plan)
+	}
+	if _, err := ExplainAnalyze(dbp, `SELECT * FROM "t"`); err == nil {
+		t.Fatal("EXPLAIN ANALYZE should be refused on sqlite")
+	}
+
+	dbp = NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.OracleDialect{}}))
+	if _, err := Explain(dbp, `SELECT * FROM "t"`); err == nil {
+		t.Fatal("EXPLAIN should be refused on unsupported dialects")
+	}
+}
+
+func TestQueryCounter(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbmap := &gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}
+	counter := &QueryCounter{}
+	dbmap.TraceOn("", counter)
+
+	dbp := NewTempDBProvider(NewDB(dbmap))
+	defer dbp.Close()
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertValue(t, dbp, value1)
+	expectValue(t, dbp, value1)
+
+	if n := counter.Count(); n != 3 {
+		t.Fatalf("expected 3 queries, got %d", n)
+	}
+	counter.Reset()
+	if n := counter.Count(); n != 0 {
+		t.Fatalf("expected 0 queries after reset, got %d", n)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertValue(t, dbp, value1)
+
+	tx(t, dbp)
+	insertValue(t, dbp, value2)
+
+	// Rows are read from the active transaction.
+	rows, err := dbp.Query(context.Background(), `SELECT id FROM "t" ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(ids) != 2 || ids[0] != value1 || ids[1] != value2 {
+		t.Fatalf("unexpected rows %v", ids)
+	}
+	rollback(t, dbp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dbp.Query(ctx, `SELECT id FROM "t"`); err == nil {
+		t.Fatal("query should fail with a canceled context")
+	}
+}
+
+func TestProviderFromContext(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	if _, ok := ProviderFromContext(context.Background()); ok {
+		t.Fatal("no provider expected in an empty context")
+	}
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx(t, dbp)
+	ctx := ContextWithProvider(context.Background(), dbp)
+
+	// The ambient provider shares the transaction of the caller.
+	ambient, ok := ProviderFromContext(ctx)
+	if !ok {
+		t.Fatal("expected a provider in the context")
+	}
+	insertValue(t, ambient, value1)
+	rollback(t, dbp)
+
+	j, err := dbp.DB().SelectNullInt(`SELECT id FROM "t"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Valid {
+		t.Fatal("insert through the ambient provider should have been rolled back")
+	}
+}
+
+func TestNamed(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT, name TEXT, alias TEXT);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NamedExec(dbp, `INSERT INTO "t" (id, name, alias) VALUES (:id, :name, :name)`, map[string]interface{}{
+		"id":   value1,
+		"name": "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	_, err = NamedSelect(dbp, &names, `SELECT name FROM "t" WHERE id = :id AND alias = :name AND name != ':id'`, map[string]interface{}{
+		"id":   value1,
+		"name": "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "foo" {
+		t.Fatalf("unexpected rows %v", names)
+	}
+
+	if _, err := NamedExec(dbp, `DELETE FROM "t" WHERE id = :id`, nil); err == nil || !strings.Contains(err.Error(), `"id"`) {
+		t.Fatalf("expected an error for the missing parameter, got %v", err)
+	}
+
+	q, args, err := bindNamed(gorp.PostgresDialect{}, `SELECT :a::text, :b, :a`, map[string]interface{}{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != `SELECT $1::text, $2, $3` || len(args) != 3 || args[0] != 1 || args[1] != 2 || args[2] != 1 {
+		t.Fatalf("unexpected query %q with args %v", q, args)
+	}
+}
+
+func TestTxDepth(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	expectDepth := func(depth int) {
+		t.Helper()
+		if d := dbp.TxDepth(); d != depth {
+			t.Fatalf("expected depth %d, got %d", depth, d)
+		}
+		if dbp.InTx() != (depth > 0) {
+			t.Fatalf("unexpected InTx %v at depth %d", dbp.InTx(), depth)
+		}
+	}
+	expectDepth(0)
+	tx(t, dbp)
+	expectDepth(1)
+	tx(t, dbp)
+	expectDepth(2)
+	sp := txSavepoint(t, dbp)
+	tx(t, dbp)
+	expectDepth(4)
+	rollbackTo(t, dbp, sp)
+	expectDepth(2)
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectDepth(1)
+	rollback(t, dbp)
+	expectDepth(0)
+}
+
+func TestTxHooks(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	var calls []string
+	hook := func(name string) func() {
+		return func() { calls = append(calls, name) }
+	}
+	expectCalls := func(expected ...string) {
+		t.Helper()
+		if strings.Join(calls, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected calls %v, got %v", expected, calls)
+		}
+		calls = nil
+	}
+
+	tx(t, dbp)
+	dbp.OnCommit(hook("commit1"))
+	dbp.OnRollback(hook("rollback1"))
+	tx(t, dbp)
+	dbp.OnCommit(hook("commit2"))
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// Inner commit.
+	expectCalls()
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls("commit1", "commit2")
+
+	// Hooks are cleared once the transaction ended.
+	tx(t, dbp)
+	dbp.OnCommit(hook("commit3"))
+	dbp.OnRollback(hook("rollback2"))
+	sp := txSavepoint(t, dbp)
+	dbp.OnRollback(hook("rollback3"))
+	rollbackTo(t, dbp, sp)
+	expectCalls()
+	rollback(t, dbp)
+	// Hooks registered after the savepoint were
+	// discarded when rolling back to it.
+	expectCalls("rollback2")
+
+	tx(t, dbp)
+	dbp.OnCommit(hook("commit5"))
+	sp = txSavepoint(t, dbp)
+	dbp.OnCommit(hook("commit6"))
+	txSavepoint(t, dbp)
+	dbp.OnCommit(hook("commit7"))
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	rollbackTo(t, dbp, sp)
+	dbp.OnCommit(hook("commit8"))
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls("commit5", "commit8")
+
+	tx(t, dbp)
+	if err := dbp.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls()
+
+	// Outside of a transaction.
+	dbp.OnCommit(hook("commit4"))
+	dbp.OnRollback(hook("rollback4"))
+	expectCalls("commit4")
+}
+
+func TestReadDB(t *testing.T) {
+	newDB := func(name string) DB {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`CREATE TABLE "t" (name TEXT); INSERT INTO "t" VALUES (?)`, name); err != nil {
+			t.Fatal(err)
+		}
+		return NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}})
+	}
+	if err := RegisterDBWithReplicas("replicated", newDB("primary"), newDB("replica1"), newDB("replica2")); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterDB("replicated")
+
+	dbp, err := NewDBProvider("replicated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbp.Close()
+
+	read := func(exec gorp.SqlExecutor) string {
+		t.Helper()
+		name, err := exec.SelectStr(`SELECT name FROM "t"`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	if name := read(dbp.DB()); name != "primary" {
+		t.Fatalf("expected DB to use the primary, got %s", name)
+	}
+	if r1, r2, r3 := read(dbp.ReadDB()), read(dbp.ReadDB()), read(dbp.ReadDB()); r1 != "replica1" || r2 != "replica2" || r3 != "replica1" {
+		t.Fatalf("expected ReadDB to use the replicas in turn, got %s, %s, %s", r1, r2, r3)
+	}
+
+	tx(t, dbp)
+	if name := read(dbp.ReadDB()); name != "primary" {
+		t.Fatalf("expected ReadDB to use the primary within a transaction, got %s", name)
+	}
+	rollback(t, dbp)
+
+	// Reads stick to the primary after a write.
+	dbp.(StickyProvider).StickToPrimaryAfterWrite(time.Hour)
+	if name := read(dbp.ReadDB()); name != "replica2" {
+		t.Fatalf("expected ReadDB to use a replica before a write, got %s", name)
+	}
+	if _, err := dbp.DB().Exec(`UPDATE "t" SET name = name`); err != nil {
+		t.Fatal(err)
+	}
+	if name := read(dbp.ReadDB()); name != "primary" {
+		t.Fatalf("expected ReadDB to use the primary after a write, got %s", name)
+	}
+	dbp.(StickyProvider).StickToPrimaryAfterWrite(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if name := read(dbp.ReadDB()); name != "replica1" {
+		t.Fatalf("expected ReadDB to use a replica once the window elapsed, got %s", name)
+	}
+	dbp.(StickyProvider).StickToPrimaryAfterWrite(0)
+
+	// Commits count as writes, tracked per provider.
+	other, err := NewDBProvider("replicated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.(StickyProvider).StickToPrimaryAfterWrite(time.Hour)
+	tx(t, other)
+	if err := other.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if name := read(other.ReadDB()); name != "primary" {
+		t.Fatalf("expected ReadDB to use the primary after a commit, got %s", name)
+	}
+	if name := read(dbp.ReadDB()); name != "replica2" {
+		t.Fatalf("expected the writes of another provider to be ignored, got %s", name)
+	}
+
+	// The dialect is found through the replicated DB.
+	if _, err := Explain(dbp, `SELECT name FROM "t"`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without replicas, ReadDB uses the DB.
+	dbp = NewTempDBProvider(newDB("single"))
+	if name := read(dbp.ReadDB()); name != "single" {
+		t.Fatalf("unexpected ReadDB %s", name)
+	}
+}
+
+func TestScanResultSets(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	dbp := NewTempDBProvider(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}))
+	defer dbp.Close()
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "t" (id BIGINT, user_name TEXT); INSERT INTO "t" VALUES (1, 'foo'), (2, 'bar');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		ID   int64
+		Name string `db:"user_name"`
+	}
+	rows, err := dbp.Query(context.Background(), `SELECT id, user_name FROM "t" ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []*row
+	if err := ScanResultSets(rows, &result); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(result) != 2 || *result[0] != (row{1, "foo"}) || *result[1] != (row{2, "bar"}) {
+		t.Fatalf("unexpected rows %+v", result)
+	}
+
+	rows, err = dbp.Query(context.Background(), `SELECT user_name FROM "t" ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, other []string
+	// sqlite returns a single result set.
+	err = ScanResultSets(rows, &names, &other)
+	rows.Close()
+	if err == nil || !strings.Contains(err.Error(), "missing result set 1") {
+		t.Fatalf("expected an error for the missing result set, got %v", err)
+	}
+	if len(names) != 2 || names[0] != "foo" || names[1] != "bar" {
+		t.Fatalf("unexpected rows %v", names)
+	}
+
+	type Named struct {
+		Name string `db:"user_name"`
+	}
+	type embedded struct {
+		ID int64
+		*Named
+	}
+	rows, err = dbp.Query(context.Background(), `SELECT id, user_name FROM "t" ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var embeds []embedded
+	if err := ScanResultSets(rows, &embeds); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(embeds) != 2 || embeds[1].ID != 2 || embeds[1].Named == nil || embeds[1].Name != "bar" {
+		t.Fatalf("unexpected rows %+v", embeds)
+	}
+
+	_, err = dbp.DB().Exec(`CREATE TABLE "ev" (ts TIMESTAMP); INSERT INTO "ev" VALUES ('2024-01-02 03:04:05');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = dbp.Query(context.Background(), `SELECT ts FROM "ev"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var times []time.Time
+	if err := ScanResultSets(rows, &times); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(times) != 1 || !times[0].Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected rows %v", times)
+	}
+
+	rows, err = dbp.Query(context.Background(), `SELECT id, user_name AS unknown FROM "t"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if err := ScanResultSets(rows, &result); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expected an error for the unmapped column, got %v", err)
+	}
+}
+
+func TestShardedProvider(t *testing.T) {
+	names := []string{"shard0", "shard1"}
+	for _, name := range names {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`CREATE TABLE "t" (name TEXT); INSERT INTO "t" VALUES (?)`, name); err != nil {
+			t.Fatal(err)
+		}
+		if err := RegisterDB(NewDB(&gorp.DbMap{Db: db, Dialect: gorp.SqliteDialect{}}), name); err != nil {
+			t.Fatal(err)
+		}
+		defer UnregisterDB(name)
+	}
+	sp, err := NewShardedProvider(names, func(key interface{}) int { return key.(int) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[int]string{0: "shard0", 1: "shard1", 2: "shard0", -1: "shard1"} {
+		name, err := sp.For(key).DB().SelectStr(`SELECT name FROM "t"`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != expected {
+			t.Errorf("expected key %d on %s, got %s", key, expected, name)
+		}
+	}
+	// The provider of a shard keeps its transaction.
+	tx(t, sp.For(1))
+	if !sp.For(3).InTx() || sp.For(0).InTx() {
+		t.Fatal("the transaction should only apply to its shard")
+	}
+	rollback(t, sp.For(1))
+
+	shards := sp.Shards()
+	if len(shards) != 2 {
+		t.Fatalf("expected 2 shards, got %d", len(shards))
+	}
+	shards[0], shards[1] = shards[1], shards[0]
+	if sp.For(0) != sp.Shards()[0] || sp.For(0) == shards[0] {
+		t.Fatal("changing the returned shards should not change the routing")
+	}
+	if _, err := NewShardedProvider([]string{"shard0", "unknown"}, func(interface{}) int { return 0 }); err == nil {
+		t.Fatal("expected an error for an unknown database")
+	}
+}